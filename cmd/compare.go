@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"crdb-ory-load-test/internal/report"
+	"crdb-ory-load-test/internal/stats"
+)
+
+// minSamples is the number of interval samples each run needs before a
+// difference is tested for significance.
+const minSamples = 3
+
+// comparison holds the thresholds of `compare` and the reports compared.
+type comparison struct {
+	maxThroughputDrop    float64
+	maxLatencyIncrease   float64
+	maxErrorRateIncrease float64
+	alpha                float64
+	baseline, candidate  *report.Report
+}
+
+// metric is one compared value of an operation. sample extracts it from an
+// interval sample, when the report has any, for the significance test.
+type metric struct {
+	label      string
+	unit       string
+	base, cand float64
+	sample     func(report.Interval) float64
+}
+
+// runCompare implements `crdb-ory-load-test compare baseline.json
+// candidate.json`. It returns the process exit code: 0 without
+// regression, 1 with regressions and 2 when the reports cannot be read.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	c := &comparison{}
+	fs.Float64Var(&c.maxThroughputDrop, "max-throughput-drop", 5, "Throughput drop, in percent, reported as a regression")
+	fs.Float64Var(&c.maxLatencyIncrease, "max-latency-increase", 10, "Latency percentile increase, in percent, reported as a regression")
+	fs.Float64Var(&c.maxErrorRateIncrease, "max-error-rate-increase", 1, "Error rate increase, in percentage points, reported as a regression")
+	fs.Float64Var(&c.alpha, "alpha", 0.05, "Significance level of the Mann-Whitney U test on interval samples")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: crdb-ory-load-test compare [flags] baseline.json candidate.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var err error
+	if c.baseline, err = report.ReadFile(fs.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if c.candidate, err = report.ReadFile(fs.Arg(1)); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("📊 Comparing %s (%s) → %s (%s)\n", fs.Arg(0), c.baseline.StartedAt.Format("2006-01-02 15:04"),
+		fs.Arg(1), c.candidate.StartedAt.Format("2006-01-02 15:04"))
+	regressions := c.compare()
+
+	if regressions > 0 {
+		fmt.Printf("\n❌ %d regression(s) beyond thresholds (throughput -%.1f%%, latency +%.1f%%, errors +%.1fpt, alpha %.2f)\n",
+			regressions, c.maxThroughputDrop, c.maxLatencyIncrease, c.maxErrorRateIncrease, c.alpha)
+		return 1
+	}
+	fmt.Println("\n✅ No regression")
+	return 0
+}
+
+// compare prints the deltas of every operation of every service found in
+// the baseline and returns the number of regressions.
+func (c *comparison) compare() int {
+	regressions := 0
+	for _, base := range c.baseline.Services {
+		cand := findService(c.candidate, base.Name)
+		if cand == nil {
+			fmt.Printf("\n⚠️  %s: missing from candidate\n", base.Name)
+			continue
+		}
+		for _, bo := range base.Operations {
+			co := findOperation(cand, bo.Name)
+			fmt.Printf("\n🔹 %s %s\n", base.Name, bo.Name)
+			if co == nil {
+				fmt.Println("   ⚠️  missing from candidate")
+				continue
+			}
+
+			bi, ci := intervals(&base, bo.Name), intervals(cand, bo.Name)
+			latency := func(label string, b, c float64, value func(report.Latency) float64) metric {
+				return metric{label, "ms", b, c, func(i report.Interval) float64 { return value(i.Latency) }}
+			}
+			for _, m := range []metric{
+				{"throughput", "ops/s", bo.Throughput, co.Throughput, func(i report.Interval) float64 { return i.Throughput }},
+				{"errors", "%", errorRate(bo), errorRate(*co), nil},
+				latency("p50", bo.ResponseTime.P50, co.ResponseTime.P50, func(l report.Latency) float64 { return l.P50 }),
+				latency("p90", bo.ResponseTime.P90, co.ResponseTime.P90, func(l report.Latency) float64 { return l.P90 }),
+				latency("p99", bo.ResponseTime.P99, co.ResponseTime.P99, func(l report.Latency) float64 { return l.P99 }),
+				latency("p99.9", bo.ResponseTime.P999, co.ResponseTime.P999, func(l report.Latency) float64 { return l.P999 }),
+			} {
+				change, verdict, regression := c.assess(m, bi, ci)
+				if regression {
+					regressions++
+				}
+				fmt.Printf("   %-10s %10.2f → %10.2f %-5s %s  %s\n", m.label, m.base, m.cand, m.unit, change, verdict)
+			}
+			if len(bi) < minSamples || len(ci) < minSamples {
+				fmt.Printf("   💡 fewer than %d interval samples, differences were not tested for significance\n", minSamples)
+			}
+		}
+	}
+	return regressions
+}
+
+// assess returns the change of m from the baseline, formatted, its verdict
+// and whether it is a regression. bi and ci are the interval samples of the
+// operation in both runs, tested for significance when there are enough.
+func (c *comparison) assess(m metric, bi, ci []report.Interval) (change, verdict string, regression bool) {
+	var beyond bool
+	switch delta, ok := percentChange(m.base, m.cand); {
+	case m.unit == "%":
+		// Error rates are compared in percentage points.
+		delta = m.cand - m.base
+		change = fmt.Sprintf("%+7.1fpt", delta)
+		beyond = delta > c.maxErrorRateIncrease
+	case !ok:
+		// Nothing to compare with: an operation that was idle in the
+		// baseline, or a latency the baseline did not record.
+		return fmt.Sprintf("%8s", "n/a"), "🆕 no baseline", false
+	case m.unit == "ops/s":
+		change = fmt.Sprintf("%+7.1f%%", delta)
+		beyond = -delta > c.maxThroughputDrop
+	default:
+		change = fmt.Sprintf("%+7.1f%%", delta)
+		beyond = delta > c.maxLatencyIncrease
+	}
+	if !beyond {
+		return change, "✅", false
+	}
+
+	if m.sample == nil || len(bi) < minSamples || len(ci) < minSamples {
+		return change, "❌ regression", true
+	}
+	p := stats.MannWhitneyU(samples(bi, m.sample), samples(ci, m.sample))
+	if p < c.alpha {
+		return change, fmt.Sprintf("❌ regression (p=%.3f)", p), true
+	}
+	return change, fmt.Sprintf("〰️  within noise (p=%.3f)", p), false
+}
+
+func findService(r *report.Report, name string) *report.Service {
+	for i := range r.Services {
+		if r.Services[i].Name == name {
+			return &r.Services[i]
+		}
+	}
+	return nil
+}
+
+func findOperation(s *report.Service, name string) *report.Operation {
+	for i := range s.Operations {
+		if s.Operations[i].Name == name {
+			return &s.Operations[i]
+		}
+	}
+	return nil
+}
+
+// intervals returns the interval samples of one operation.
+func intervals(s *report.Service, op string) []report.Interval {
+	var out []report.Interval
+	for _, i := range s.Intervals {
+		if i.Operation == op && i.Count > 0 {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func samples(intervals []report.Interval, value func(report.Interval) float64) []float64 {
+	out := make([]float64, len(intervals))
+	for i, iv := range intervals {
+		out[i] = value(iv)
+	}
+	return out
+}
+
+func errorRate(o report.Operation) float64 {
+	if o.Count == 0 {
+		return 0
+	}
+	return 100 * float64(o.Failed) / float64(o.Count)
+}
+
+// percentChange returns the change from base to cand in percent, 0 when
+// both are zero. It returns false when only base is zero, which no
+// percentage describes.
+func percentChange(base, cand float64) (float64, bool) {
+	switch {
+	case base == cand:
+		return 0, true
+	case base == 0:
+		return 0, false
+	}
+	return 100 * (cand - base) / base, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"crdb-ory-load-test/internal/report"
+)
+
+func TestPercentChange(t *testing.T) {
+	for _, tc := range []struct {
+		base, cand float64
+		want       float64
+		ok         bool
+	}{
+		{100, 110, 10, true},
+		{100, 50, -50, true},
+		{0, 0, 0, true},
+		{0, 5, 0, false},
+		{5, 0, -100, true},
+	} {
+		got, ok := percentChange(tc.base, tc.cand)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("percentChange(%g, %g) = %g, %v, want %g, %v", tc.base, tc.cand, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestAssess(t *testing.T) {
+	c := &comparison{maxThroughputDrop: 5, maxLatencyIncrease: 10, maxErrorRateIncrease: 1, alpha: 0.05}
+	throughput := func(i report.Interval) float64 { return i.Throughput }
+	runs := func(values ...float64) []report.Interval {
+		out := make([]report.Interval, len(values))
+		for i, v := range values {
+			out[i] = report.Interval{Throughput: v, Count: 1}
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		name       string
+		m          metric
+		bi, ci     []report.Interval
+		regression bool
+		verdict    string
+	}{
+		{"latency within threshold", metric{"p99", "ms", 100, 105, nil}, nil, nil, false, "✅"},
+		{"latency beyond threshold", metric{"p99", "ms", 100, 120, nil}, nil, nil, true, "❌ regression"},
+		{"latency from zero", metric{"p99", "ms", 0, 120, nil}, nil, nil, false, "🆕 no baseline"},
+		{"throughput from zero", metric{"throughput", "ops/s", 0, 500, throughput}, nil, nil, false, "🆕 no baseline"},
+		{"throughput to zero", metric{"throughput", "ops/s", 500, 0, throughput}, nil, nil, true, "❌ regression"},
+		{"error rate from zero", metric{"errors", "%", 0, 2, nil}, nil, nil, true, "❌ regression"},
+		{"significant drop", metric{"throughput", "ops/s", 1000, 800, throughput},
+			runs(990, 1000, 1010, 1005, 995), runs(790, 800, 810, 805, 795), true, "❌ regression (p=0.012)"},
+		{"drop within noise", metric{"throughput", "ops/s", 1000, 900, throughput},
+			runs(700, 1300, 1000, 900, 1100), runs(800, 1000, 900, 850, 950), false, "〰️  within noise"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, verdict, regression := c.assess(tc.m, tc.bi, tc.ci)
+			if regression != tc.regression || !strings.HasPrefix(verdict, tc.verdict) {
+				t.Errorf("assess() = %q, %v, want %q, %v", verdict, regression, tc.verdict, tc.regression)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/health"
+)
+
+// Defaults for the circuit breaker settings left unset.
+const (
+	defaultBreakerWindow   = 10 * time.Second
+	defaultBreakerRequests = 20
+	defaultProbeInterval   = 5 * time.Second
+	breakerCheckInterval   = 200 * time.Millisecond
+)
+
+// breaker watches the error rate of a run over a sliding window of
+// one-second buckets. When it exceeds the budget, the breaker either
+// cancels the run or pauses the workers and probes the service's health
+// until it recovers.
+type breaker struct {
+	budget   float64 // error rate, 0..1
+	minOps   int64
+	pause    bool
+	interval time.Duration
+	probe    func() error
+	// resume is called when a paused run resumes, e.g. to drop the pacer
+	// slots missed meanwhile.
+	resume func()
+	// now is the clock of the window.
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets []bucket
+	// closed is closed while requests may flow, and replaced by an open
+	// channel while the breaker holds them back.
+	closed chan struct{}
+}
+
+type bucket struct {
+	second int64
+	ops    int64
+	failed int64
+}
+
+// newBreaker returns the breaker configured by cfg, or nil when disabled.
+func newBreaker(cfg config.CircuitBreaker, probe func() error) *breaker {
+	if cfg.ErrorRate <= 0 {
+		return nil
+	}
+	window := time.Duration(cfg.WindowSec) * time.Second
+	if window <= 0 {
+		window = defaultBreakerWindow
+	}
+	b := &breaker{
+		budget:   cfg.ErrorRate / 100,
+		minOps:   int64(cfg.MinRequests),
+		pause:    cfg.Action == "pause",
+		interval: time.Duration(cfg.ProbeIntervalSec) * time.Second,
+		probe:    probe,
+		buckets:  make([]bucket, int(window/time.Second)),
+		closed:   make(chan struct{}),
+		now:      time.Now,
+	}
+	if b.minOps <= 0 {
+		b.minOps = defaultBreakerRequests
+	}
+	if b.interval <= 0 {
+		b.interval = defaultProbeInterval
+	}
+	close(b.closed)
+	return b
+}
+
+// record counts the outcome of one operation.
+func (b *breaker) record(err error) {
+	if b == nil {
+		return
+	}
+	now := b.now().Unix()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bk := &b.buckets[now%int64(len(b.buckets))]
+	if bk.second != now {
+		*bk = bucket{second: now}
+	}
+	bk.ops++
+	if err != nil {
+		bk.failed++
+	}
+}
+
+// errorRate returns the operations and error rate over the window.
+func (b *breaker) errorRate() (int64, float64) {
+	oldest := b.now().Unix() - int64(len(b.buckets))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ops, failed int64
+	for _, bk := range b.buckets {
+		if bk.second > oldest {
+			ops += bk.ops
+			failed += bk.failed
+		}
+	}
+	if ops == 0 {
+		return 0, 0
+	}
+	return ops, float64(failed) / float64(ops)
+}
+
+// tripped returns why the breaker trips, or "" while the window holds
+// fewer than minOps operations or the error rate is within the budget.
+func (b *breaker) tripped() string {
+	ops, rate := b.errorRate()
+	if ops < b.minOps || rate <= b.budget {
+		return ""
+	}
+	return fmt.Sprintf("error rate %.1f%% over the last %ds exceeded the %.1f%% budget",
+		100*rate, len(b.buckets), 100*b.budget)
+}
+
+// wait blocks while the breaker holds requests back. It returns false once
+// done is closed.
+func (b *breaker) wait(done <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	select {
+	case <-closed:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// watch checks the error rate until ctx is done. It returns why the run
+// was aborted, or "" if it was not. cancel aborts the run.
+func (b *breaker) watch(ctx context.Context, cancel context.CancelFunc, name string) string {
+	if b == nil {
+		return ""
+	}
+	t := time.NewTicker(breakerCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ""
+		}
+
+		reason := b.tripped()
+		if reason == "" {
+			continue
+		}
+		if !b.pause {
+			log.Printf("🧯 %s circuit breaker tripped: %s, aborting", name, reason)
+			cancel()
+			return reason
+		}
+
+		log.Printf("⏸️  %s circuit breaker tripped: %s, pausing until /health/alive answers", name, reason)
+		b.mu.Lock()
+		b.closed = make(chan struct{})
+		b.mu.Unlock()
+		if !b.recover(ctx, name) {
+			return ""
+		}
+	}
+}
+
+// recover probes the service until it answers, then lets requests flow
+// again with a clean window. It returns false if ctx is done first.
+func (b *breaker) recover(ctx context.Context, name string) bool {
+	for {
+		select {
+		case <-time.After(b.interval):
+		case <-ctx.Done():
+			return false
+		}
+		if err := b.probe(); err != nil {
+			log.Printf("⏸️  %s health probe failed: %v", name, err)
+			continue
+		}
+
+		log.Printf("▶️  %s is alive again, resuming", name)
+		if b.resume != nil {
+			b.resume()
+		}
+		b.mu.Lock()
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+		close(b.closed)
+		b.mu.Unlock()
+		return true
+	}
+}
+
+// alive returns a probe of the /health/alive endpoint of the API at
+// baseURL.
+func alive(baseURL *string) func() error {
+	return func() error {
+		if baseURL == nil {
+			return fmt.Errorf("no API URL configured")
+		}
+		_, err := health.Alive(*baseURL)
+		return err
+	}
+}
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+func TestBreakerTrip(t *testing.T) {
+	// outcomes are recorded age seconds before the check.
+	type outcomes struct {
+		age        int
+		ok, failed int
+	}
+	for _, tc := range []struct {
+		name     string
+		outcomes []outcomes
+		trip     bool
+	}{
+		{"below the minimum requests", []outcomes{{0, 0, 19}}, false},
+		{"at the minimum requests", []outcomes{{0, 9, 11}}, true},
+		{"at the budget", []outcomes{{0, 18, 2}}, false},
+		{"over the budget", []outcomes{{0, 90, 11}}, true},
+		{"spread over the window", []outcomes{{9, 0, 10}, {5, 5, 5}, {0, 10, 0}}, true},
+		{"failures aged out", []outcomes{{10, 0, 100}, {0, 20, 0}}, false},
+		{"failures about to age out", []outcomes{{9, 0, 100}, {0, 20, 0}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBreaker(config.CircuitBreaker{ErrorRate: 10, WindowSec: 10, MinRequests: 20}, nil)
+			check := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+			for _, o := range tc.outcomes {
+				at := check.Add(-time.Duration(o.age) * time.Second)
+				b.now = func() time.Time { return at }
+				for i := 0; i < o.ok; i++ {
+					b.record(nil)
+				}
+				for i := 0; i < o.failed; i++ {
+					b.record(errors.New("500"))
+				}
+			}
+
+			b.now = func() time.Time { return check }
+			if reason := b.tripped(); (reason != "") != tc.trip {
+				t.Errorf("tripped() = %q, want trip %v", reason, tc.trip)
+			}
+		})
+	}
+}
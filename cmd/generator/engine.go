@@ -0,0 +1,558 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+
+	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
+	"crdb-ory-load-test/internal/logging"
+	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/report"
+	"crdb-ory-load-test/internal/stats"
+)
+
+// Defaults for the workload settings left unset.
+const (
+	defaultConcurrency = 100
+	defaultQueueDepth  = 10000
+)
+
+var seedOnce sync.Once
+
+// seedFaker seeds gofakeit once per process: reseeding is not safe while
+// another workload is generating data with it.
+func seedFaker() {
+	seedOnce.Do(func() { gofakeit.Seed(0) })
+}
+
+// workload describes the operations of one Ory service. By default it runs
+// a write-then-read pattern: every successful writeOp produces an entity
+// that is read back read_ratio times with readOp. When the service has an
+// operation mix configured, a pool of workers instead picks operations by
+// weight.
+type workload[T any] struct {
+	name    string
+	readOp  string // operation checking entities, e.g. "check"
+	writeOp string // operation creating entities, e.g. "write"
+
+	// ops holds every operation the service supports, by name.
+	ops map[string]operation[T]
+	// mix holds the configured operation weights, if any.
+	mix map[string]float64
+
+	outcomes [2]string // result labels of the check counter for a positive and a negative readOp
+
+	// probe checks the service's health while the circuit breaker holds
+	// the run.
+	probe func() error
+}
+
+// operation is one Ory API call of a workload. Exactly one of create and
+// use is set.
+type operation[T any] struct {
+	// write counts the operation as a write rather than a read.
+	write bool
+	// create makes a new entity in Ory.
+	create func(context.Context) (T, error)
+	// use calls Ory with an existing entity; the boolean is the positive
+	// outcome (active token or identity, allowed permission).
+	use func(context.Context, T) (bool, error)
+	// consume drops the entity once used, e.g. after deleting a tuple.
+	consume bool
+}
+
+// result holds the counters of a workload run. Workers record into it
+// concurrently while the run is in progress.
+type result struct {
+	name        string
+	start       time.Time
+	duration    time.Duration
+	concurrency int
+	positive    stats.Counter
+	negative    stats.Counter
+	// reads counts every read, failed or not; writes only the successful
+	// writes. stageResult counts them the same way.
+	reads        stats.Counter
+	writes       stats.Counter
+	failedReads  stats.Counter
+	failedWrites stats.Counter
+	// evicted counts entities dropped from a full queue before all their
+	// reads were done.
+	evicted stats.Counter
+
+	targetReadRate  float64
+	targetWriteRate float64
+
+	readLatency  latency
+	writeLatency latency
+
+	// ops breaks the run down per operation; mixed is set for runs of an
+	// operation mix.
+	ops   map[string]*opResult
+	mixed bool
+	// stages breaks the run down per stage of workload.stages, if any.
+	stages []*stageResult
+	// intervals holds the samples of each workload.interval_sec.
+	intervals []report.Interval
+	// aborted is why the circuit breaker aborted the run, if it did.
+	aborted string
+}
+
+// opResult holds the counters of one operation of a mix.
+type opResult struct {
+	count   stats.Counter
+	failed  stats.Counter
+	latency latency
+}
+
+// stageResult holds the counters of the operations scheduled during one
+// stage of the profile.
+type stageResult struct {
+	stage
+	reads        stats.Counter
+	writes       stats.Counter
+	failedReads  stats.Counter
+	failedWrites stats.Counter
+	readLatency  latency
+	writeLatency latency
+}
+
+func (s *stageResult) count(read bool, err error) {
+	if s == nil {
+		return
+	}
+	switch {
+	case read:
+		s.reads.Inc()
+		if err != nil {
+			s.failedReads.Inc()
+		}
+	case err != nil:
+		s.failedWrites.Inc()
+	default:
+		s.writes.Inc()
+	}
+}
+
+func (s *stageResult) latency(read bool) latency {
+	switch {
+	case s == nil:
+		return latency{}
+	case read:
+		return s.readLatency
+	default:
+		return s.writeLatency
+	}
+}
+
+// latency holds the two views of an operation's latency. service is
+// measured from when the request was actually sent; response is measured
+// from when it was scheduled to be sent, so time spent waiting behind a
+// slow Ory response counts too (correcting for coordinated omission, as
+// HdrHistogram and wrk2 do). Both are equal for unpaced runs.
+type latency struct {
+	service  *stats.Histogram
+	response *stats.Histogram
+}
+
+func newLatency() latency {
+	return latency{service: stats.NewHistogram(), response: stats.NewHistogram()}
+}
+
+// runner holds the state shared by the workers of one workload run.
+type runner[T any] struct {
+	w      workload[T]
+	cfg    config.Workload
+	prof   *profile
+	ctx    context.Context
+	done   <-chan struct{}
+	start  time.Time
+	end    time.Time
+	dryRun bool
+	res    *result
+	m      *metrics.Collectors
+	iv     *intervals
+	br     *breaker
+	// gate holds back the workers beyond the current concurrency, when
+	// the profile changes it.
+	gate   *gate
+	cancel context.CancelFunc
+	// tripped receives the abort reason of the circuit breaker.
+	tripped chan string
+}
+
+// run drives w through the configured load profile, either with the
+// write-then-read pattern or with the service's operation mix. When a rate
+// is set, operations follow an open-loop schedule at that rate instead of
+// running as fast as the workers allow. A run with duration_sec 0 lasts
+// until ctx is cancelled; either way, in-flight requests complete before
+// run returns.
+func run[T any](ctx context.Context, w workload[T], dryRun bool) *result {
+	cfg := config.AppConfig.Workload
+	prof, err := newProfile(cfg, strings.ToLower(w.name))
+	if err != nil {
+		logging.From(ctx).Error("❌ Load generation aborted", "service", strings.ToLower(w.name), "error", err)
+		return &result{readLatency: newLatency(), writeLatency: newLatency()}
+	}
+	startTime := time.Now()
+	endTime := startTime.Add(prof.total)
+
+	var cancel context.CancelFunc
+	if prof.total == 0 {
+		// Indefinite run: schedule as far ahead as the pacer may ever need.
+		endTime = startTime.Add(100 * 365 * 24 * time.Hour)
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, endTime)
+	}
+	defer cancel()
+
+	res := &result{
+		name:         w.name,
+		start:        startTime,
+		readLatency:  newLatency(),
+		writeLatency: newLatency(),
+		ops:          map[string]*opResult{},
+	}
+	for name := range w.ops {
+		res.ops[name] = &opResult{latency: newLatency()}
+	}
+	if prof.flat && len(w.mix) > 0 {
+		// A mix is paced as a whole, at the sum of both rates.
+		res.targetReadRate = cfg.ChecksPerSecond + cfg.WritesPerSecond
+	} else if prof.flat {
+		res.targetReadRate, res.targetWriteRate = cfg.ChecksPerSecond, cfg.WritesPerSecond
+	} else if len(cfg.Stages) > 0 {
+		for _, s := range prof.stages {
+			res.stages = append(res.stages, &stageResult{stage: s, readLatency: newLatency(), writeLatency: newLatency()})
+		}
+	}
+
+	r := &runner[T]{w: w, cfg: cfg, prof: prof, ctx: ctx, done: ctx.Done(), start: startTime, end: endTime, dryRun: dryRun, res: res, m: metrics.From(ctx)}
+	r.iv = startIntervals(res, startTime, time.Duration(cfg.IntervalSec)*time.Second)
+	if !prof.flat {
+		r.gate = startGate(prof, startTime, r.done)
+	}
+	if !dryRun {
+		r.br, r.cancel = newBreaker(cfg.CircuitBreaker, w.probe), cancel
+	}
+	if len(w.mix) > 0 || len(prof.ops) > 0 {
+		res.mixed = true
+		r.runMix()
+	} else {
+		r.runReadRatio()
+	}
+	r.iv.close()
+	if r.tripped != nil {
+		cancel()
+		res.aborted = <-r.tripped
+	}
+
+	res.duration = time.Since(startTime)
+	if ctx.Err() == context.Canceled && res.aborted == "" {
+		log.Printf("🛑 %s Load generation interrupted after %v", w.name, res.duration.Round(time.Millisecond))
+	}
+	return res
+}
+
+// length describes the run duration for the start-up log line.
+func (r *runner[T]) length() string {
+	if r.prof.total == 0 {
+		return "an unlimited time (until interrupted)"
+	}
+	return r.prof.total.String()
+}
+
+// runReadRatio runs workload.writers writers and concurrency (or the
+// stages' peak concurrency) readers, or no readers with read_ratio 0. Each write queues its entity to be
+// read back read_ratio times; readers block on the queue until there is
+// something to read, and writers never wait for readers, evicting the
+// oldest entity once queue_depth entities are waiting.
+func (r *runner[T]) runReadRatio() {
+	readPacer := newPacer(r.prof.pacedReads, r.start, r.end, r.prof.readRate, r.prof.rateChange)
+	writePacer := newPacer(r.prof.pacedWrites, r.start, r.end, r.prof.writeRate, r.prof.rateChange)
+
+	writeWorkers := r.cfg.Writers
+	if writeWorkers <= 0 {
+		writeWorkers = 1
+	}
+	readWorkers := r.prof.readers
+	if r.cfg.ReadRatio == 0 {
+		// Nothing is queued to be read back: the run only writes.
+		readWorkers = 0
+	}
+	r.res.concurrency = writeWorkers + readWorkers
+	depth := r.cfg.QueueDepth
+	if depth <= 0 {
+		depth = defaultQueueDepth
+	}
+
+	log.Printf("🚧 %s Load generation for %s with %d total workers (%d writers, %d readers, queue depth %d)...",
+		r.w.name, r.length(), r.res.concurrency, writeWorkers, readWorkers, depth)
+
+	r.watch(readPacer, writePacer)
+	var wg sync.WaitGroup
+	entities := newQueue[T](depth, r.m.QueueDepthGauge.WithLabelValues(strings.ToLower(r.w.name)))
+
+	// Phase 1: Start write worker(s)
+	for i := 0; i < writeWorkers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			ctx := r.workerContext("writer", workerID)
+			for r.ctx.Err() == nil {
+				if !r.br.wait(r.done) {
+					return
+				}
+				intended := time.Now()
+				if writePacer != nil {
+					slot, ok := writePacer.wait(r.done)
+					if !ok {
+						return
+					}
+					intended = slot
+				}
+				if r.dryRun {
+					if writePacer == nil {
+						<-r.done
+						return
+					}
+					continue
+				}
+
+				var zero T
+				entity, err := r.perform(ctx, r.w.writeOp, zero, intended)
+				if err != nil {
+					continue
+				}
+				entities.push(entity, r.cfg.ReadRatio)
+			}
+		}(i)
+	}
+
+	// Phase 2: Start read workers
+	for i := 0; i < readWorkers; i++ {
+		wg.Add(1)
+		go func(readerID int) {
+			defer wg.Done()
+			ctx := r.workerContext("reader", readerID)
+			for r.ctx.Err() == nil {
+				// Readers beyond the current stage's concurrency stand by.
+				if !r.standBy(readerID) || !r.br.wait(r.done) {
+					return
+				}
+
+				// The entity is taken before the pacer slot, and a slot
+				// that came due before the entity was written counts from
+				// the write: time spent waiting for writers is lag of the
+				// generator, not response time of Ory.
+				e, queued, ok := entities.pop(r.done)
+				if !ok {
+					return
+				}
+				// Unpaced reads start once there is something to read.
+				intended := time.Now()
+				if readPacer != nil {
+					slot, ok := readPacer.wait(r.done)
+					if !ok {
+						return
+					}
+					intended = slot
+					if intended.Before(queued) {
+						intended = queued
+					}
+				}
+				r.perform(ctx, r.w.readOp, e, intended)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	r.res.evicted.Add(entities.evictions())
+}
+
+// watch starts the circuit breaker, if any, before the workers start.
+// While paused, the breaker holds the workers at the top of their loop;
+// on resume, the pacers skip the slots missed meanwhile rather than
+// issuing them all at once.
+func (r *runner[T]) watch(pacers ...*pacer) {
+	if r.br == nil {
+		return
+	}
+	r.br.resume = func() {
+		for _, p := range pacers {
+			p.skip()
+		}
+	}
+	r.tripped = make(chan string, 1)
+	go func() { r.tripped <- r.br.watch(r.ctx, r.cancel, r.w.name) }()
+}
+
+// workerContext returns the context of the requests a worker sends, which
+// names it in the events file and carries its logger. It is not cancelled
+// with the run, so that in-flight requests complete.
+func (r *runner[T]) workerContext(kind string, id int) context.Context {
+	worker := fmt.Sprintf("%s-%d", kind, id)
+	ctx := logging.With(context.WithoutCancel(r.ctx), slog.With("service", strings.ToLower(r.w.name), "worker", worker))
+	return events.WithWorker(ctx, worker)
+}
+
+// standBy blocks worker id while it is beyond the concurrency of the
+// current stage. It returns false once the run is over.
+func (r *runner[T]) standBy(id int) bool {
+	return r.gate.wait(id, r.done)
+}
+
+// stageOf returns the stage an operation scheduled at intended belongs to,
+// or nil when the run has no stages.
+func (r *runner[T]) stageOf(intended time.Time) *stageResult {
+	if r.res.stages == nil {
+		return nil
+	}
+	return r.res.stages[r.prof.stageAt(intended.Sub(r.start))]
+}
+
+// perform runs the named operation (on e for operations using an entity)
+// with ctx and records its outcome. It returns the entity created, if any.
+// Dry runs record the operation without calling Ory.
+func (r *runner[T]) perform(ctx context.Context, name string, e T, intended time.Time) (T, error) {
+	op := r.w.ops[name]
+	st := r.stageOf(intended)
+	or := r.res.ops[name]
+
+	var created T
+	var positive bool
+	var err error
+	if !r.dryRun {
+		start := time.Now()
+		if op.create != nil {
+			created, err = op.create(ctx)
+		} else {
+			positive, err = op.use(ctx, e)
+		}
+		r.observe(name, intended, start, r.res.latency(!op.write), st.latency(!op.write), or.latency)
+		r.br.record(err)
+	}
+
+	or.count.Inc()
+	if err != nil {
+		or.failed.Inc()
+	}
+	st.count(!op.write, err)
+
+	if op.write {
+		if err != nil {
+			r.res.failedWrites.Inc()
+			r.m.WriteCounter.WithLabelValues(strings.ToLower(r.w.name), name, "failure").Inc()
+		} else {
+			r.res.writes.Inc()
+			r.m.WriteCounter.WithLabelValues(strings.ToLower(r.w.name), name, "success").Inc()
+		}
+		return created, err
+	}
+
+	if err != nil {
+		r.res.failedReads.Inc()
+	}
+	if name == r.w.readOp {
+		if positive {
+			r.m.Checks(strings.ToLower(r.w.name)).WithLabelValues(r.w.outcomes[0]).Inc()
+			r.res.positive.Inc()
+		}
+		if !positive && err == nil {
+			r.m.Checks(strings.ToLower(r.w.name)).WithLabelValues(r.w.outcomes[1]).Inc()
+			r.res.negative.Inc()
+		}
+	}
+	r.res.reads.Inc()
+	return created, err
+}
+
+func (res *result) latency(read bool) latency {
+	if read {
+		return res.readLatency
+	}
+	return res.writeLatency
+}
+
+// observe records the latency of an operation that was scheduled at
+// intended, sent at start and has just completed.
+func (r *runner[T]) observe(op string, intended, start time.Time, ls ...latency) {
+	end := time.Now()
+	service, response := end.Sub(start), end.Sub(intended)
+	for _, l := range ls {
+		if l.service != nil {
+			l.service.Record(service)
+			l.response.Record(response)
+		}
+	}
+
+	r.iv.record(op, response)
+
+	svc := strings.ToLower(r.w.name)
+	r.m.ServiceTimeHistogram.WithLabelValues(svc, op).Observe(service.Seconds())
+	r.m.ResponseTimeHistogram.WithLabelValues(svc, op).Observe(response.Seconds())
+}
+
+// logLatency prints the service and response time percentiles of one
+// operation, with label padded to width to line up with the summary.
+func logLatency(label string, width int, l latency) {
+	for _, v := range []struct {
+		kind string
+		h    *stats.Histogram
+	}{{"service", l.service}, {"response", l.response}} {
+		if v.h.Count() == 0 {
+			continue
+		}
+		log.Printf("⌛ %-*s p50 %v  p90 %v  p99 %v  p99.9 %v  max %v", width, label+" "+v.kind+":",
+			v.h.Quantile(0.50), v.h.Quantile(0.90), v.h.Quantile(0.99), v.h.Quantile(0.999), v.h.Max())
+	}
+}
+
+// logCalls prints a percentile table of every Ory API call the service's
+// client made, e.g. both steps of a Kratos registration.
+func logCalls(service string) {
+	names := stats.Calls.Names(strings.ToLower(service))
+	if len(names) == 0 {
+		return
+	}
+	log.Printf("📋 %-18s %8s %10s %10s %10s %10s %10s", "Ory call", "count", "p50", "p90", "p99", "p99.9", "max")
+	for _, name := range names {
+		h := stats.Calls.Histogram(strings.ToLower(service), name)
+		log.Printf("📋 %-18s %8d %10v %10v %10v %10v %10v", name, h.Count(),
+			h.Quantile(0.50), h.Quantile(0.90), h.Quantile(0.99), h.Quantile(0.999), h.Max())
+	}
+}
+
+// logStages prints one line per stage of a multi-stage run.
+func logStages(res *result) {
+	for i, s := range res.stages {
+		d := (s.end - s.start).Seconds()
+		log.Printf("📶 Stage %d %-12s %6v → %.0f checks/s, %.0f writes/s, %.0f readers | %.1f checks/s, %.1f writes/s, %d failed | read p50 %v p99 %v",
+			i+1, s.name, s.end-s.start, s.to.reads, s.to.writes, s.to.concurrency,
+			float64(s.reads.Load())/d, float64(s.writes.Load())/d, s.failedReads.Load()+s.failedWrites.Load(),
+			s.readLatency.response.Quantile(0.50), s.readLatency.response.Quantile(0.99))
+	}
+}
+
+// paced returns the number of operations counted against targetReadRate:
+// reads, or every operation of a mix.
+func (r *result) paced() int64 {
+	if r.mixed {
+		return r.reads.Load() + r.writes.Load()
+	}
+	return r.reads.Load()
+}
+
+// rate returns n operations per second of the actual run duration.
+func (r *result) rate(n int64) float64 {
+	return stats.Throughput(n, r.duration)
+}
@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"sync"
+	"time"
+)
+
+// gate holds back the workers beyond the concurrency the profile sets at
+// the current time. A goroutine follows the profile, sleeping until the
+// next time the concurrency may change, and wakes the workers held back
+// whenever it does.
+type gate struct {
+	mu     sync.Mutex
+	active int
+	// changed is closed, and replaced, when active changes.
+	changed chan struct{}
+}
+
+// startGate starts following prof for a run started at start, until done
+// is closed.
+func startGate(prof *profile, start time.Time, done <-chan struct{}) *gate {
+	g := &gate{active: prof.activeReaders(time.Since(start)), changed: make(chan struct{})}
+	go func() {
+		for {
+			next, ok := prof.nextChange(time.Since(start))
+			if !ok {
+				return
+			}
+			t := time.NewTimer(time.Until(start.Add(next)))
+			select {
+			case <-t.C:
+				g.set(prof.activeReaders(time.Since(start)))
+			case <-done:
+				t.Stop()
+				return
+			}
+		}
+	}()
+	return g
+}
+
+func (g *gate) set(active int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if active == g.active {
+		return
+	}
+	g.active = active
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// wait blocks worker id while it is beyond the active concurrency. It
+// returns false once done is closed.
+func (g *gate) wait(id int, done <-chan struct{}) bool {
+	if g == nil {
+		return true
+	}
+	for {
+		g.mu.Lock()
+		active, changed := g.active, g.changed
+		g.mu.Unlock()
+		if id < active {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-done:
+			return false
+		}
+	}
+}
@@ -1,133 +1,126 @@
 package generator
 
 import (
+	"context"
+	"errors"
 	"log"
-	"sync"
+	"log/slog"
 	"time"
-    "github.com/brianvoe/gofakeit/v6"
+
+	"github.com/brianvoe/gofakeit/v6"
 	"github.com/google/uuid"
 
 	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
 	"crdb-ory-load-test/internal/hydra"
-	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/logging"
+	"crdb-ory-load-test/internal/report"
 )
 
 type clientCredentials struct {
-	ClientID         string
-	ClientSecret     string
-	AccessToken      string
+	ClientID     string
+	ClientSecret string
+	AccessToken  string
 }
 
-func RunHydraWorkload(dryRun bool) {
-	cfg := config.AppConfig.Workload
-	duration := time.Duration(cfg.DurationSec) * time.Second
-	endTime := time.Now().Add(duration)
-	gofakeit.Seed(0)
-
-	writeWorkers := 1
-	readWorkers := cfg.ReadRatio
-	totalWorkers := writeWorkers + readWorkers
-
-    clientID := uuid.New().String()
-    clientName := "hydra-load-test-client"
-    clientSecret := gofakeit.Password(true, true, true, true, false, 26)
-
-	log.Printf("🚧 Hydra Load generation for %v with %d total workers (%d writers, %d readers)...",
-		duration, totalWorkers, writeWorkers, readWorkers)
-
-    if !dryRun {
-        created, err := hydra.CreateOAuth2Client(clientID, clientName, clientSecret)
-        if err != nil || !created {
-            log.Printf("❌ OAuth2 client creation failed: %v", err)
-            return
-        }
-        log.Printf("🏛️ Hydra OAuth2 Client Created with ID: %s", clientID)
-    }
-
-	var wg sync.WaitGroup
-	credentialsChannel := make(chan clientCredentials, 10000)
-
-	var activeTokenCount, inactiveTokenCount, failedReads, failedWrites, readCount, writeCount int64
-
-	// Phase 1: Start write worker(s)
-	for i := 0; i < writeWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for time.Now().Before(endTime) {
-				if !dryRun {
-					token, err := hydra.GrantClientCredentials(clientID, clientSecret)
-					if err != nil || token == "" {
-						log.Printf("❌  Client Credentials Grant failed: %v", err)
-						failedWrites++
-					} else {
-					    log.Printf("🎟️  Access Token generated for Client %s", clientID)
-						// Push the same identity read_ratio times
-						for j := 0; j < cfg.ReadRatio; j++ {
-							credentialsChannel <- clientCredentials{ClientID: clientID, ClientSecret: clientSecret, AccessToken: token}
-						}
-						writeCount++
-					}
-				}
-			}
-		}(i)
+// RunHydraWorkload runs the Hydra workload and prints its summary. It returns
+// the outcome for the run report, or nil if the workload did not run.
+func RunHydraWorkload(ctx context.Context, dryRun bool) *report.Service {
+	res, ok := runHydra(ctx, dryRun)
+	if !ok {
+		return nil
 	}
+	logHydraSummary(res, dryRun)
+	return res.report()
+}
 
-	// Phase 2: Start read workers
-	for i := 0; i < readWorkers; i++ {
-		wg.Add(1)
-		go func(readerID int) {
-			defer wg.Done()
-			for time.Now().Before(endTime) {
-				select {
-				case t := <-credentialsChannel:
-					active := false
-					var err error
-					if !dryRun {
-						active, err = hydra.IntrospectToken(t.AccessToken)
-						if active {
-						    log.Printf("👀 Token introspection: Access Token for client %s is Active=%v", t.ClientID, active)
-						} else if err != nil {
-						    failedReads++
-						}
-					}
+func runHydra(ctx context.Context, dryRun bool) (*result, bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	seedFaker()
+
+	clientID := uuid.New().String()
+	clientName := "hydra-load-test-client"
+	clientSecret := gofakeit.Password(true, true, true, true, false, 26)
+
+	if !dryRun {
+		created, err := hydra.CreateOAuth2Client(events.WithEntities(ctx, clientID), clientID, clientName, clientSecret)
+		if err != nil || !created {
+			logging.From(ctx).Error("❌ OAuth2 client creation failed", "service", "hydra", "op", "create_client", "error", err)
+			return nil, false
+		}
+		log.Printf("🏛️ Hydra OAuth2 Client Created with ID: %s", clientID)
+	}
 
-					if active {
-						metrics.OAuthTokenCheckCounter.WithLabelValues("active").Inc()
-						activeTokenCount++
-					}
-                    if !active && err == nil {
-						metrics.OAuthTokenCheckCounter.WithLabelValues("inactive").Inc()
-						inactiveTokenCount++
-					}
-					readCount++
-				default:
-					time.Sleep(5 * time.Millisecond)
+	return run(ctx, workload[clientCredentials]{
+		name:    "Hydra",
+		readOp:  "introspect",
+		writeOp: "grant",
+		ops: map[string]operation[clientCredentials]{
+			"grant": {write: true, create: func(ctx context.Context) (clientCredentials, error) {
+				token, err := hydra.GrantClientCredentials(events.WithEntities(ctx, clientID), clientID, clientSecret)
+				if err == nil && token == "" {
+					err = errors.New("empty access token")
 				}
-			}
-		}(i)
-	}
+				if err != nil {
+					logging.From(ctx).Error("❌  Client Credentials Grant failed", "op", "grant", "error", err)
+					return clientCredentials{}, err
+				}
+				logging.From(ctx).Debug("🎟️  Access Token generated", "op", "grant", "client", clientID)
+				return clientCredentials{ClientID: clientID, ClientSecret: clientSecret, AccessToken: token}, nil
+			}},
+			"introspect": {use: func(ctx context.Context, t clientCredentials) (bool, error) {
+				active, err := hydra.IntrospectToken(events.WithEntities(ctx, t.ClientID), t.AccessToken)
+				if active {
+					logging.From(ctx).Debug("👀 Token introspection", "op", "introspect", "client", t.ClientID, "active", active)
+				}
+				return active, err
+			}},
+		},
+		mix:      config.AppConfig.Hydra.Operations,
+		outcomes: [2]string{"active", "inactive"},
+		probe:    alive(config.AppConfig.Hydra.AdminAPI),
+	}, dryRun), true
+}
 
-	wg.Wait()
+func logHydraSummary(res *result, dryRun bool) {
 	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
 	log.Println("✅  Hydra Load generation and access token introspections complete")
-	log.Printf("⏱️  Duration:               %v", duration)
-	log.Printf("⚙️  Concurrency:            %d", totalWorkers)
-	log.Printf("🚦 Checks/sec:             %.1f", float64(readCount)/float64(cfg.DurationSec))
+	log.Printf("⏱️  Duration:               %v", res.duration.Round(time.Millisecond))
+	if res.aborted != "" {
+		log.Printf("🧯 Aborted:                %s", res.aborted)
+	}
+	log.Printf("⚙️  Concurrency:            %d", res.concurrency)
+	log.Printf("🚦 Checks/sec:             %.1f", res.rate(res.reads.Load()))
+	if res.targetReadRate > 0 {
+		log.Printf("🎯 Target checks/sec:      %.1f (achieved %.1f%%)", res.targetReadRate, 100*res.rate(res.paced())/res.targetReadRate)
+	}
+	if res.targetWriteRate > 0 {
+		log.Printf("🎯 Target writes/sec:      %.1f (achieved %.1f, %.1f%%)", res.targetWriteRate, res.rate(res.writes.Load()), 100*res.rate(res.writes.Load())/res.targetWriteRate)
+	}
 	log.Printf("🧪 Mode:                   %s", map[bool]string{true: "DRY RUN", false: "LIVE"}[dryRun])
-	log.Printf("🟢 Active:                 %d", activeTokenCount)
-	log.Printf("🔴 Inactive:               %d", inactiveTokenCount)
-	log.Printf("✏️  Writes:                 %d", writeCount)
-	log.Printf("👁️  Reads:                  %d", readCount)
-	if writeCount > 0 {
-	log.Printf("📊 Read/Write ratio:       %.1f:1", float64(readCount)/float64(writeCount))
+	log.Printf("🟢 Active:                 %d", res.positive.Load())
+	log.Printf("🔴 Inactive:               %d", res.negative.Load())
+	log.Printf("✏️  Writes:                 %d", res.writes.Load())
+	log.Printf("👁️  Reads:                  %d", res.reads.Load())
+	if res.writes.Load() > 0 {
+		log.Printf("📊 Read/Write ratio:       %.1f:1", float64(res.reads.Load())/float64(res.writes.Load()))
 	}
-	log.Printf("🚨 Failed writes to Hydra: %d", failedWrites)
-	log.Printf("🚨 Failed reads to Hydra:  %d", failedReads)
+	if res.evicted.Load() > 0 {
+		log.Printf("♻️  Evicted unread:         %d", res.evicted.Load())
+	}
+	logLatency("Read", 23, res.readLatency)
+	logLatency("Write", 23, res.writeLatency)
+	logStages(res)
+	logOperations(res)
+	logCalls(res.name)
+	log.Printf("🚨 Failed writes to Hydra: %d", res.failedWrites.Load())
+	log.Printf("🚨 Failed reads to Hydra:  %d", res.failedReads.Load())
 
 	if dryRun {
-		log.Println("⚠️  Dry-run mode: No tuples were written to Hydra.")
+		slog.Warn("⚠️  Dry-run mode: No tuples were written to Hydra.")
 	}
 
-    log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
+	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
 }
@@ -0,0 +1,154 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"crdb-ory-load-test/internal/report"
+	"crdb-ory-load-test/internal/stats"
+)
+
+// intervalOutput receives the status lines, and every interval sample as
+// one JSON object per line (NDJSON) when set with SetIntervalOutput.
+var intervalOutput = struct {
+	mu     sync.Mutex
+	status io.Writer
+	enc    *json.Encoder
+}{status: os.Stdout}
+
+// SetIntervalOutput sends every interval sample to w as NDJSON, in addition
+// to the status lines on stdout.
+func SetIntervalOutput(w io.Writer) {
+	intervalOutput.mu.Lock()
+	defer intervalOutput.mu.Unlock()
+	intervalOutput.enc = json.NewEncoder(w)
+}
+
+// writeInterval prints the status line of sample, which is on stdout
+// whatever the log settings, and writes the sample to the interval output.
+func writeInterval(sample report.Interval) {
+	intervalOutput.mu.Lock()
+	defer intervalOutput.mu.Unlock()
+	fmt.Fprintf(intervalOutput.status, "%s ⏲️  %-6s %8v %-12s %8.1f ops/s (cum %8.1f) %5d errors | p50 %6.1fms p95 %6.1fms p99 %6.1fms (cum p50 %6.1fms p95 %6.1fms p99 %6.1fms)\n",
+		time.Now().Format("2006/01/02 15:04:05"), sample.Service, time.Duration(sample.ElapsedSec*float64(time.Second)).Round(time.Second),
+		sample.Operation, sample.Throughput, sample.CumulativeThroughput, sample.Errors,
+		sample.Latency.P50, sample.Latency.P95, sample.Latency.P99,
+		sample.CumulativeLatency.P50, sample.CumulativeLatency.P95, sample.CumulativeLatency.P99)
+	if intervalOutput.enc == nil {
+		return
+	}
+	if err := intervalOutput.enc.Encode(sample); err != nil {
+		slog.Warn("⚠️  Failed to write interval sample", "error", err)
+		intervalOutput.enc = nil
+	}
+}
+
+// intervals prints a status line per operation every interval of a run,
+// with the throughput, errors and response time percentiles of the
+// interval next to the cumulative ones, like `cockroach workload` does.
+type intervals struct {
+	res   *result
+	start time.Time
+	ops   map[string]*intervalOp
+	stop  chan struct{}
+	done  sync.WaitGroup
+}
+
+// intervalOp holds the state of one operation since the last interval.
+type intervalOp struct {
+	latency    *stats.Histogram
+	lastCount  int64
+	lastFailed int64
+}
+
+// startIntervals starts reporting on res every interval, or returns nil
+// when every is zero. Call close to end it.
+func startIntervals(res *result, start time.Time, every time.Duration) *intervals {
+	if every <= 0 {
+		return nil
+	}
+	iv := &intervals{res: res, start: start, ops: map[string]*intervalOp{}, stop: make(chan struct{})}
+	for name := range res.ops {
+		iv.ops[name] = &intervalOp{latency: stats.NewHistogram()}
+	}
+
+	iv.done.Add(1)
+	go func() {
+		defer iv.done.Done()
+		t := time.NewTicker(every)
+		defer t.Stop()
+		last := start
+		for {
+			select {
+			case now := <-t.C:
+				iv.tick(now.Sub(last))
+				last = now
+			case <-iv.stop:
+				return
+			}
+		}
+	}()
+	return iv
+}
+
+// record adds the response time of one operation to the current interval.
+func (iv *intervals) record(op string, d time.Duration) {
+	if iv == nil {
+		return
+	}
+	if o := iv.ops[op]; o != nil {
+		o.latency.Record(d)
+	}
+}
+
+// close ends the reporting. The last, partial interval is not reported.
+func (iv *intervals) close() {
+	if iv == nil {
+		return
+	}
+	close(iv.stop)
+	iv.done.Wait()
+}
+
+func (iv *intervals) tick(length time.Duration) {
+	elapsed := time.Since(iv.start)
+	names := make([]string, 0, len(iv.ops))
+	for name := range iv.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		o, cum := iv.ops[name], iv.res.ops[name]
+		h := o.latency.Drain()
+		count, failed := cum.count.Load(), cum.failed.Load()
+		if count == 0 {
+			continue
+		}
+
+		sample := report.Interval{
+			Service:              iv.res.name,
+			Operation:            name,
+			ElapsedSec:           elapsed.Seconds(),
+			IntervalSec:          length.Seconds(),
+			Count:                count - o.lastCount,
+			Errors:               failed - o.lastFailed,
+			Throughput:           stats.Throughput(count-o.lastCount, length),
+			CumulativeCount:      count,
+			CumulativeErrors:     failed,
+			CumulativeThroughput: stats.Throughput(count, elapsed),
+			Latency:              report.NewLatency(h),
+			CumulativeLatency:    report.NewLatency(cum.latency.response),
+		}
+		o.lastCount, o.lastFailed = count, failed
+		iv.res.intervals = append(iv.res.intervals, sample)
+
+		writeInterval(sample)
+	}
+}
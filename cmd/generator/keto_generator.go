@@ -1,14 +1,18 @@
 package generator
 
 import (
+	"context"
 	"log"
-	"sync"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
+
 	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
 	"crdb-ory-load-test/internal/keto"
-	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/logging"
+	"crdb-ory-load-test/internal/report"
 )
 
 type tuple struct {
@@ -16,104 +20,103 @@ type tuple struct {
 	Object  string
 }
 
-func RunKetoWorkload(dryRun bool) {
-	cfg := config.AppConfig.Workload
-	duration := time.Duration(cfg.DurationSec) * time.Second
-	endTime := time.Now().Add(duration)
-
-	writeWorkers := 1
-	readWorkers := cfg.ReadRatio
-	totalWorkers := writeWorkers + readWorkers
-
-	var wg sync.WaitGroup
-	tupleChannel := make(chan tuple, 10000)
-
-	var allowedCount, deniedCount, failedReads, failedWrites, readCount, writeCount int64
+// context attributes the requests sent with ctx to the tuple.
+func (t tuple) context(ctx context.Context) context.Context {
+	return events.WithEntities(ctx, t.Object, t.Subject)
+}
 
-	log.Printf("🚧 Keto Load generation for %v with %d total workers (%d writers, %d readers)...",
-		duration, totalWorkers, writeWorkers, readWorkers)
+// RunKetoWorkload runs the Keto workload and prints its summary. It returns
+// the outcome for the run report, or nil if the workload did not run.
+func RunKetoWorkload(ctx context.Context, dryRun bool) *report.Service {
+	res, ok := runKeto(ctx, dryRun)
+	if !ok {
+		return nil
+	}
+	logKetoSummary(res, dryRun)
+	return res.report()
+}
 
-	// Phase 1: Start write worker(s)
-	for i := 0; i < writeWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for time.Now().Before(endTime) {
+func runKeto(ctx context.Context, dryRun bool) (*result, bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	return run(ctx, workload[tuple]{
+		name:    "Keto",
+		readOp:  "check",
+		writeOp: "write",
+		ops: map[string]operation[tuple]{
+			"write": {write: true, create: func(ctx context.Context) (tuple, error) {
 				objectID := uuid.New().String()
 				subjectID := uuid.New().String()
 				subjectFull := "user:" + subjectID
 
-				if !dryRun {
-					err := keto.WriteTuple("documents", objectID, "viewer", subjectFull)
-					if err != nil {
-						log.Printf("❌ WriteTuple failed: %v", err)
-						failedWrites++
-					} else {
-						// Push the same tuple read_ratio times
-						for j := 0; j < cfg.ReadRatio; j++ {
-							tupleChannel <- tuple{Subject: subjectFull, Object: objectID}
-						}
-						writeCount++
-					}
+				ctx = events.WithEntities(ctx, objectID, subjectFull)
+				if err := keto.WriteTuple(ctx, "documents", objectID, "viewer", subjectFull); err != nil {
+					logging.From(ctx).Error("❌ WriteTuple failed", "op", "write", "error", err)
+					return tuple{}, err
 				}
-			}
-		}(i)
-	}
-
-	// Phase 2: Start read workers
-	for i := 0; i < readWorkers; i++ {
-		wg.Add(1)
-		go func(readerID int) {
-			defer wg.Done()
-			for time.Now().Before(endTime) {
-				select {
-				case t := <-tupleChannel:
-					allowed := false
-					var err error
-					if !dryRun {
-						allowed, err = keto.CheckPermission("documents", t.Object, "viewer", t.Subject)
-						if allowed {
-						    log.Printf("🔒 Permission check result: subject=%s, object=%s, allowed=%v", t.Subject, t.Object, allowed)
-					    } else if err != nil {
-                            failedReads++
-                        }
-					}
-
-					if allowed {
-						metrics.PermissionCheckCounter.WithLabelValues("allowed").Inc()
-						allowedCount++
-					}
-                    if !allowed && err == nil {
-						metrics.PermissionCheckCounter.WithLabelValues("denied").Inc()
-						deniedCount++
-					}
-					readCount++
-				default:
-					time.Sleep(5 * time.Millisecond)
+				return tuple{Subject: subjectFull, Object: objectID}, nil
+			}},
+			"check": {use: func(ctx context.Context, t tuple) (bool, error) {
+				allowed, err := keto.CheckPermission(t.context(ctx), "documents", t.Object, "viewer", t.Subject)
+				if allowed {
+					logging.From(ctx).Debug("🔒 Permission check result", "op", "check", "subject", t.Subject, "object", t.Object, "allowed", allowed)
 				}
-			}
-		}(i)
-	}
+				return allowed, err
+			}},
+			"expand": {use: func(ctx context.Context, t tuple) (bool, error) {
+				return keto.ExpandPermission(t.context(ctx), "documents", t.Object, "viewer", 3)
+			}},
+			"delete": {write: true, consume: true, use: func(ctx context.Context, t tuple) (bool, error) {
+				if err := keto.DeleteTuple(t.context(ctx), "documents", t.Object, "viewer", t.Subject); err != nil {
+					logging.From(ctx).Error("❌ DeleteTuple failed", "op", "delete", "error", err)
+					return false, err
+				}
+				return true, nil
+			}},
+		},
+		mix:      config.AppConfig.Keto.Operations,
+		outcomes: [2]string{"allowed", "denied"},
+		probe:    alive(config.AppConfig.Keto.ReadAPI),
+	}, dryRun), true
+}
 
-	wg.Wait()
+func logKetoSummary(res *result, dryRun bool) {
 	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
 	log.Println("✅  Keto Load generation and permission checks complete")
-	log.Printf("⏱️  Duration:              %v", duration)
-	log.Printf("⚙️  Concurrency:           %d", totalWorkers)
-	log.Printf("🚦 Checks/sec:            %.1f", float64(readCount)/float64(cfg.DurationSec))
+	log.Printf("⏱️  Duration:              %v", res.duration.Round(time.Millisecond))
+	if res.aborted != "" {
+		log.Printf("🧯 Aborted:               %s", res.aborted)
+	}
+	log.Printf("⚙️  Concurrency:           %d", res.concurrency)
+	log.Printf("🚦 Checks/sec:            %.1f", res.rate(res.reads.Load()))
+	if res.targetReadRate > 0 {
+		log.Printf("🎯 Target checks/sec:     %.1f (achieved %.1f%%)", res.targetReadRate, 100*res.rate(res.paced())/res.targetReadRate)
+	}
+	if res.targetWriteRate > 0 {
+		log.Printf("🎯 Target writes/sec:     %.1f (achieved %.1f, %.1f%%)", res.targetWriteRate, res.rate(res.writes.Load()), 100*res.rate(res.writes.Load())/res.targetWriteRate)
+	}
 	log.Printf("🧪 Mode:                  %s", map[bool]string{true: "DRY RUN", false: "LIVE"}[dryRun])
-	log.Printf("✔️  Allowed:               %d", allowedCount)
-	log.Printf("🚫 Denied:                %d", deniedCount)
-	log.Printf("✏️  Writes:                %d", writeCount)
-	log.Printf("👁️  Reads:                 %d", readCount)
-	if writeCount > 0 {
-	    log.Printf("📊 Read/Write ratio:      %.1f:1", float64(readCount)/float64(writeCount))
+	log.Printf("✔️  Allowed:               %d", res.positive.Load())
+	log.Printf("🚫 Denied:                %d", res.negative.Load())
+	log.Printf("✏️  Writes:                %d", res.writes.Load())
+	log.Printf("👁️  Reads:                 %d", res.reads.Load())
+	if res.writes.Load() > 0 {
+		log.Printf("📊 Read/Write ratio:      %.1f:1", float64(res.reads.Load())/float64(res.writes.Load()))
+	}
+	if res.evicted.Load() > 0 {
+		log.Printf("♻️  Evicted unread:        %d", res.evicted.Load())
 	}
-	log.Printf("🚨 Failed writes to Keto: %d", failedWrites)
-	log.Printf("🚨 Failed reads to Keto:  %d", failedReads)
+	logLatency("Read", 22, res.readLatency)
+	logLatency("Write", 22, res.writeLatency)
+	logStages(res)
+	logOperations(res)
+	logCalls(res.name)
+	log.Printf("🚨 Failed writes to Keto: %d", res.failedWrites.Load())
+	log.Printf("🚨 Failed reads to Keto:  %d", res.failedReads.Load())
 
 	if dryRun {
-		log.Println("⚠️  Dry-run mode: No tuples were written to Keto.")
+		slog.Warn("⚠️  Dry-run mode: No tuples were written to Keto.")
 	}
 
 	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
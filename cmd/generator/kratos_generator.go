@@ -1,122 +1,116 @@
 package generator
 
 import (
+	"context"
+	"errors"
 	"log"
-	"sync"
+	"log/slog"
 	"time"
-    "github.com/brianvoe/gofakeit/v6"
+
+	"github.com/brianvoe/gofakeit/v6"
+
 	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
 	"crdb-ory-load-test/internal/kratos"
-	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/logging"
+	"crdb-ory-load-test/internal/report"
 )
 
 type identity struct {
-	Email      string
-	FirstName  string
-	LastName   string
+	Email     string
+	FirstName string
+	LastName  string
 }
 
-func RunKratosWorkload(dryRun bool) {
-	cfg := config.AppConfig.Workload
-	duration := time.Duration(cfg.DurationSec) * time.Second
-	endTime := time.Now().Add(duration)
-    gofakeit.Seed(0)
-
-	writeWorkers := 1
-	readWorkers := cfg.ReadRatio
-	totalWorkers := writeWorkers + readWorkers
-
-	var wg sync.WaitGroup
-	identityChannel := make(chan identity, 10000)
-
-	var activeIdentityCount, inactiveIdentityCount, failedReads, failedWrites, readCount, writeCount int64
+// RunKratosWorkload runs the Kratos workload and prints its summary. It returns
+// the outcome for the run report, or nil if the workload did not run.
+func RunKratosWorkload(ctx context.Context, dryRun bool) *report.Service {
+	res, ok := runKratos(ctx, dryRun)
+	if !ok {
+		return nil
+	}
+	logKratosSummary(res, dryRun)
+	return res.report()
+}
 
-	log.Printf("🚧 Kratos Load generation for %v with %d total workers (%d writers, %d readers)...",
-		duration, totalWorkers, writeWorkers, readWorkers)
+func runKratos(ctx context.Context, dryRun bool) (*result, bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	seedFaker()
 
-	// Phase 1: Start write worker(s)
-	for i := 0; i < writeWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for time.Now().Before(endTime) {
-			    email     := gofakeit.Email()
+	return run(ctx, workload[identity]{
+		name:    "Kratos",
+		readOp:  "check",
+		writeOp: "register",
+		ops: map[string]operation[identity]{
+			"register": {write: true, create: func(ctx context.Context) (identity, error) {
+				email := gofakeit.Email()
 				firstName := gofakeit.FirstName()
-				lastName  := gofakeit.LastName()
-				password  := gofakeit.Password(true, true, true, true, false, 8)
+				lastName := gofakeit.LastName()
+				password := gofakeit.Password(true, true, true, true, false, 8)
 
-				if !dryRun {
-					created, err := kratos.RegisterIdentity(email, firstName, lastName, password)
-					if err != nil || !created {
-						log.Printf("❌ Write Identity failed: %v", err)
-						failedWrites++
-					} else {
-						// Push the same identity read_ratio times
-						for j := 0; j < cfg.ReadRatio; j++ {
-							identityChannel <- identity{Email: email, FirstName: firstName, LastName: lastName}
-						}
-						writeCount++
-					}
+				created, err := kratos.RegisterIdentity(events.WithEntities(ctx, email), email, firstName, lastName, password)
+				if err == nil && !created {
+					err = errors.New("identity not created")
 				}
-			}
-		}(i)
-	}
-
-	// Phase 2: Start read workers
-	for i := 0; i < readWorkers; i++ {
-		wg.Add(1)
-		go func(readerID int) {
-			defer wg.Done()
-			for time.Now().Before(endTime) {
-				select {
-				case t := <-identityChannel:
-					active := false
-					var err error
-					if !dryRun {
-						active, err = kratos.CheckIdentity(t.Email)
-						if active {
-						    log.Printf("🔒 Identity check result: email=%s, firstName=%s, lastName=%s, active=%v", t.Email, t.FirstName, t.LastName, active)
-						} else if err != nil {
-						    failedReads++
-						}
-					}
-
-					if active {
-						metrics.IdentityCheckCounter.WithLabelValues("active").Inc()
-						activeIdentityCount++
-					}
-                    if !active && err == nil {
-						metrics.IdentityCheckCounter.WithLabelValues("inactive").Inc()
-						inactiveIdentityCount++
-					}
-					readCount++
-				default:
-					time.Sleep(5 * time.Millisecond)
+				if err != nil {
+					logging.From(ctx).Error("❌ Write Identity failed", "op", "register", "error", err)
+					return identity{}, err
 				}
-			}
-		}(i)
-	}
+				return identity{Email: email, FirstName: firstName, LastName: lastName}, nil
+			}},
+			"check": {use: func(ctx context.Context, t identity) (bool, error) {
+				active, err := kratos.CheckIdentity(events.WithEntities(ctx, t.Email), t.Email)
+				if active {
+					logging.From(ctx).Debug("🔒 Identity check result", "op", "check", "email", t.Email, "firstName", t.FirstName, "lastName", t.LastName, "active", active)
+				}
+				return active, err
+			}},
+		},
+		mix:      config.AppConfig.Kratos.Operations,
+		outcomes: [2]string{"active", "inactive"},
+		probe:    alive(config.AppConfig.Kratos.AdminAPI),
+	}, dryRun), true
+}
 
-	wg.Wait()
+func logKratosSummary(res *result, dryRun bool) {
 	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
 	log.Println("✅  Kratos Load generation and identity checks complete")
-	log.Printf("⏱️  Duration:                %v", duration)
-	log.Printf("⚙️  Concurrency:             %d", totalWorkers)
-	log.Printf("🚦 Checks/sec:              %.1f", float64(readCount)/float64(cfg.DurationSec))
+	log.Printf("⏱️  Duration:                %v", res.duration.Round(time.Millisecond))
+	if res.aborted != "" {
+		log.Printf("🧯 Aborted:                 %s", res.aborted)
+	}
+	log.Printf("⚙️  Concurrency:             %d", res.concurrency)
+	log.Printf("🚦 Checks/sec:              %.1f", res.rate(res.reads.Load()))
+	if res.targetReadRate > 0 {
+		log.Printf("🎯 Target checks/sec:       %.1f (achieved %.1f%%)", res.targetReadRate, 100*res.rate(res.paced())/res.targetReadRate)
+	}
+	if res.targetWriteRate > 0 {
+		log.Printf("🎯 Target writes/sec:       %.1f (achieved %.1f, %.1f%%)", res.targetWriteRate, res.rate(res.writes.Load()), 100*res.rate(res.writes.Load())/res.targetWriteRate)
+	}
 	log.Printf("🧪 Mode:                    %s", map[bool]string{true: "DRY RUN", false: "LIVE"}[dryRun])
-	log.Printf("🟢 Active:                  %d", activeIdentityCount)
-	log.Printf("🔴 Inactive:                %d", inactiveIdentityCount)
-	log.Printf("✏️  Writes:                  %d", writeCount)
-	log.Printf("👁️  Reads:                   %d", readCount)
-	if writeCount > 0 {
-	    log.Printf("📊 Read/Write ratio:        %.1f:1", float64(readCount)/float64(writeCount))
+	log.Printf("🟢 Active:                  %d", res.positive.Load())
+	log.Printf("🔴 Inactive:                %d", res.negative.Load())
+	log.Printf("✏️  Writes:                  %d", res.writes.Load())
+	log.Printf("👁️  Reads:                   %d", res.reads.Load())
+	if res.writes.Load() > 0 {
+		log.Printf("📊 Read/Write ratio:        %.1f:1", float64(res.reads.Load())/float64(res.writes.Load()))
 	}
-	log.Printf("🚨 Failed writes to Kratos: %d", failedWrites)
-	log.Printf("🚨 Failed reads to Kratos:  %d", failedReads)
+	if res.evicted.Load() > 0 {
+		log.Printf("♻️  Evicted unread:          %d", res.evicted.Load())
+	}
+	logLatency("Read", 24, res.readLatency)
+	logLatency("Write", 24, res.writeLatency)
+	logStages(res)
+	logOperations(res)
+	logCalls(res.name)
+	log.Printf("🚨 Failed writes to Kratos: %d", res.failedWrites.Load())
+	log.Printf("🚨 Failed reads to Kratos:  %d", res.failedReads.Load())
 
 	if dryRun {
-		log.Println("⚠️  Dry-run mode: No tuples were written to Kratos.")
+		slog.Warn("⚠️  Dry-run mode: No tuples were written to Kratos.")
 	}
 
-    log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
+	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
 }
@@ -0,0 +1,190 @@
+package generator
+
+import (
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// poolSize bounds the entities kept around for an operation mix to use.
+const poolSize = 10000
+
+// runMix runs a pool of workers, each repeatedly picking an operation of
+// the mix by weight, or in proportion to its rate when the curve paces the
+// operations. Operations needing an entity draw a random recently created
+// one; while there is none yet, the service's create operation runs
+// instead.
+func (r *runner[T]) runMix() {
+	paced := r.prof.pacedReads || r.prof.pacedWrites
+	rate := func(elapsed time.Duration) float64 {
+		t := r.prof.at(elapsed)
+		return t.reads + t.writes
+	}
+	pick := newPicker(r.w.mix)
+	if len(r.prof.ops) > 0 {
+		paced, rate, pick = true, r.prof.opsRate, r.prof.pickOp
+	}
+	p := newPacer(paced, r.start, r.end, rate, r.prof.rateChange)
+
+	workers := max(r.prof.readers, 1)
+	r.res.concurrency = workers
+	entities := &pool[T]{}
+
+	log.Printf("🚧 %s Load generation for %s with %d workers running an operation mix...",
+		r.w.name, r.length(), workers)
+
+	r.watch(p)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			ctx := r.workerContext("worker", workerID)
+			for r.ctx.Err() == nil {
+				if !r.standBy(workerID) || !r.br.wait(r.done) {
+					return
+				}
+				intended := time.Now()
+				if p != nil {
+					slot, ok := p.wait(r.done)
+					if !ok {
+						return
+					}
+					intended = slot
+				}
+
+				name := pick(intended.Sub(r.start))
+				op := r.w.ops[name]
+				var e T
+				if op.use != nil {
+					var ok bool
+					if e, ok = entities.get(op.consume); !ok {
+						name = r.w.writeOp
+						op = r.w.ops[name]
+					}
+				}
+
+				// A dry run creates zero entities, which the operations
+				// using them still draw so that the mix is previewed.
+				created, err := r.perform(ctx, name, e, intended)
+				if op.create != nil && err == nil {
+					entities.put(created)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// newPicker returns a function choosing an operation name at random,
+// proportionally to its weight.
+func newPicker(weights map[string]float64) func(time.Duration) string {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cumulative := make([]float64, len(names))
+	total := 0.0
+	for i, name := range names {
+		total += weights[name]
+		cumulative[i] = total
+	}
+
+	return func(time.Duration) string {
+		x := rand.Float64() * total
+		i := sort.SearchFloat64s(cumulative, x)
+		return names[min(i, len(names)-1)]
+	}
+}
+
+// opsRate returns the total rate the curve sets for the operations at
+// elapsed.
+func (p *profile) opsRate(elapsed time.Duration) float64 {
+	total := 0.0
+	for op := range p.ops {
+		total += p.opRate(op, elapsed)
+	}
+	return total
+}
+
+// pickOp chooses an operation of the curve at random, proportionally to its
+// rate at elapsed.
+func (p *profile) pickOp(elapsed time.Duration) string {
+	names := make([]string, 0, len(p.ops))
+	for op := range p.ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+
+	x := rand.Float64() * p.opsRate(elapsed)
+	for _, op := range names {
+		if x -= p.opRate(op, elapsed); x < 0 {
+			return op
+		}
+	}
+	return names[len(names)-1]
+}
+
+// pool keeps recently created entities. Once full, new entities replace
+// random old ones.
+type pool[T any] struct {
+	mu    sync.Mutex
+	items []T
+}
+
+func (p *pool[T]) put(e T) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.items) < poolSize {
+		p.items = append(p.items, e)
+		return
+	}
+	p.items[rand.IntN(len(p.items))] = e
+}
+
+// get returns a random entity, removing it from the pool if consume is set.
+func (p *pool[T]) get(consume bool) (T, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var zero T
+	if len(p.items) == 0 {
+		return zero, false
+	}
+	i := rand.IntN(len(p.items))
+	e := p.items[i]
+	if consume {
+		last := len(p.items) - 1
+		p.items[i] = p.items[last]
+		p.items[last] = zero
+		p.items = p.items[:last]
+	}
+	return e, true
+}
+
+// logOperations prints one line per operation of a mix.
+func logOperations(res *result) {
+	if !res.mixed {
+		return
+	}
+	names := make([]string, 0, len(res.ops))
+	var total int64
+	for name, o := range res.ops {
+		names = append(names, name)
+		total += o.count.Load()
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		o := res.ops[name]
+		if o.count.Load() == 0 {
+			continue
+		}
+		log.Printf("🧩 %-12s %5.1f%% | %d ops (%.1f/s), %d failed | p50 %v p99 %v",
+			name, 100*float64(o.count.Load())/float64(total), o.count.Load(), res.rate(o.count.Load()), o.failed.Load(),
+			o.latency.response.Quantile(0.50), o.latency.response.Quantile(0.99))
+	}
+}
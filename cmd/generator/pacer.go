@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"sync"
+	"time"
+)
+
+// pacerStep bounds how far the pacer looks ahead before re-reading the
+// rate, so ramps are followed closely even at low rates.
+const pacerStep = 10 * time.Millisecond
+
+// pacer hands out operation slots on a fixed schedule. Workers claim the
+// next slot and sleep until it is due, so the offered load is set by the
+// schedule alone and not by how many workers there are or how fast Ory
+// answers (open-loop). When every worker is busy, slots fall into the past
+// and are issued immediately on the next claim.
+type pacer struct {
+	mu     sync.Mutex
+	rateAt func(elapsed time.Duration) float64
+	// changeAt returns the next point at which the rate changes course.
+	changeAt func(elapsed time.Duration) (time.Duration, bool)
+	start    time.Time
+	end      time.Time
+	next     time.Time
+}
+
+// newPacer returns a pacer following rateAt (slots per second at a given
+// point of the run), which changes linearly between the points returned
+// by changeAt, or nil when paced is false (closed-loop, as fast as workers
+// go).
+func newPacer(paced bool, start, end time.Time, rateAt func(time.Duration) float64, changeAt func(time.Duration) (time.Duration, bool)) *pacer {
+	if !paced {
+		return nil
+	}
+	p := &pacer{rateAt: rateAt, changeAt: changeAt, start: start, end: end}
+	p.next = p.advance(start)
+	return p
+}
+
+// advance returns the time at which one more slot has accrued after t,
+// integrating the rate in pacerStep increments. Stretches where the rate
+// stays at zero are skipped in one go, and the walk gives up at the end of
+// the run, so that a zero rate neither spins nor holds the lock for long.
+func (p *pacer) advance(t time.Time) time.Time {
+	need := 1.0
+	for t.Before(p.end) {
+		r := p.rateAt(t.Sub(p.start))
+		if r == 0 {
+			next, ok := p.changeAt(t.Sub(p.start))
+			if !ok {
+				return p.end
+			}
+			if p.rateAt(next) == 0 {
+				t = p.start.Add(next)
+				continue
+			}
+		}
+		if r > 0 && r*pacerStep.Seconds() >= need {
+			return t.Add(time.Duration(need / r * float64(time.Second)))
+		}
+		need -= r * pacerStep.Seconds()
+		t = t.Add(pacerStep)
+	}
+	return t
+}
+
+// wait blocks until the next slot is due and returns its intended start
+// time. It returns false, without waiting, once the slot is past end.
+func (p *pacer) wait(done <-chan struct{}) (time.Time, bool) {
+	p.mu.Lock()
+	slot := p.next
+	if !slot.Before(p.end) {
+		p.mu.Unlock()
+		return slot, false
+	}
+	p.next = p.advance(slot)
+	p.mu.Unlock()
+
+	if d := time.Until(slot); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-done:
+			return slot, false
+		}
+	}
+	return slot, true
+}
+
+// skip drops the slots that fell into the past, e.g. while the run was
+// paused, so that the schedule resumes from now instead of catching up.
+func (p *pacer) skip() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now := time.Now(); p.next.Before(now) {
+		p.next = now
+	}
+}
@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"crdb-ory-load-test/internal/report"
+)
+
+// RunParallelWorkloads runs the Hydra, Kratos and Keto workloads at the same
+// time against their shared CockroachDB cluster, then prints each service's
+// summary followed by a combined one. It returns the outcome of each
+// workload that ran for the run report.
+func RunParallelWorkloads(ctx context.Context, dryRun bool) []*report.Service {
+	runners := []struct {
+		run     func(context.Context, bool) (*result, bool)
+		summary func(*result, bool)
+	}{
+		{runHydra, logHydraSummary},
+		{runKratos, logKratosSummary},
+		{runKeto, logKetoSummary},
+	}
+
+	results := make([]*result, len(runners))
+	var wg sync.WaitGroup
+	for i, r := range runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, ok := r.run(ctx, dryRun); ok {
+				results[i] = res
+			}
+		}()
+	}
+	wg.Wait()
+
+	var completed []*result
+	var services []*report.Service
+	for i, res := range results {
+		if res != nil {
+			runners[i].summary(res, dryRun)
+			completed = append(completed, res)
+			services = append(services, res.report())
+		}
+	}
+	if len(completed) > 1 {
+		logCombinedSummary(completed, dryRun)
+	}
+	return services
+}
+
+// logCombinedSummary prints the totals of services that ran in parallel.
+func logCombinedSummary(results []*result, dryRun bool) {
+	total := &result{readLatency: newLatency(), writeLatency: newLatency()}
+	var names []string
+	for _, r := range results {
+		names = append(names, r.name)
+		total.duration = max(total.duration, r.duration)
+		total.concurrency += r.concurrency
+		total.reads.Add(r.reads.Load())
+		total.writes.Add(r.writes.Load())
+		total.failedReads.Add(r.failedReads.Load())
+		total.failedWrites.Add(r.failedWrites.Load())
+		for _, l := range []struct{ into, from latency }{{total.readLatency, r.readLatency}, {total.writeLatency, r.writeLatency}} {
+			l.into.service.Merge(l.from.service)
+			l.into.response.Merge(l.from.response)
+		}
+	}
+
+	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
+	log.Printf("✅  Combined %s Load generation complete", strings.Join(names, " + "))
+	log.Printf("⏱️  Duration:               %v", total.duration.Round(time.Millisecond))
+	log.Printf("⚙️  Concurrency:            %d", total.concurrency)
+	log.Printf("🚦 Checks/sec:             %.1f", total.rate(total.reads.Load()))
+	log.Printf("🧪 Mode:                   %s", map[bool]string{true: "DRY RUN", false: "LIVE"}[dryRun])
+	log.Printf("✏️  Writes:                 %d", total.writes.Load())
+	log.Printf("👁️  Reads:                  %d", total.reads.Load())
+	for _, r := range results {
+		log.Printf("🔹 %-23s %.1f checks/sec, %.1f writes/sec, %d failed", r.name+":", r.rate(r.reads.Load()), r.rate(r.writes.Load()), r.failedReads.Load()+r.failedWrites.Load())
+		if r.aborted != "" {
+			log.Printf("🧯 %-23s aborted: %s", r.name+":", r.aborted)
+		}
+	}
+	logLatency("Read", 23, total.readLatency)
+	logLatency("Write", 23, total.writeLatency)
+	log.Printf("🚨 Failed writes:          %d", total.failedWrites.Load())
+	log.Printf("🚨 Failed reads:           %d", total.failedReads.Load())
+	log.Println("🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧🚧")
+}
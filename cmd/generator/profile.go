@@ -0,0 +1,254 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+// target is the load requested at one point of a run. Zero rates mean
+// "as fast as possible" unless the profile is paced.
+type target struct {
+	reads       float64
+	writes      float64
+	concurrency float64
+}
+
+// stage is one segment of a profile, ramping linearly from -> to.
+type stage struct {
+	name       string
+	start, end time.Duration
+	from, to   target
+}
+
+// profile is the load shape of a run: a single flat stage built from
+// concurrency, duration_sec and the rate settings, the ramps described by
+// workload.stages, or the segments between the points of workload.curve.
+type profile struct {
+	stages      []stage
+	total       time.Duration
+	flat        bool
+	pacedReads  bool
+	pacedWrites bool
+	readers     int
+	// ops holds the curves of the service's operations, when the curve
+	// file has any: they pace an operation mix instead of reads and
+	// writes.
+	ops map[string][]config.CurvePoint
+}
+
+// newProfile builds the profile of service from cfg.
+func newProfile(cfg config.Workload, service string) (*profile, error) {
+	base := target{
+		reads:       cfg.ChecksPerSecond,
+		writes:      cfg.WritesPerSecond,
+		concurrency: defaultConcurrency,
+	}
+	if cfg.Concurrency > 0 {
+		base.concurrency = float64(cfg.Concurrency)
+	}
+
+	p := &profile{pacedReads: base.reads > 0, pacedWrites: base.writes > 0}
+	if cfg.Curve.File != "" {
+		return p, p.fromCurve(cfg.Curve, base, service)
+	}
+	if len(cfg.Stages) == 0 {
+		p.total = time.Duration(cfg.DurationSec) * time.Second
+		p.stages = []stage{{name: "steady", end: p.total, from: base, to: base}}
+		p.flat = true
+		p.readers = int(base.concurrency)
+		return p, nil
+	}
+
+	// Ramps start from zero for every target a stage sets, and from the
+	// base config for the ones no stage sets.
+	from := base
+	for _, s := range cfg.Stages {
+		if s.ChecksPerSecond != nil {
+			p.pacedReads, from.reads = true, 0
+		}
+		if s.WritesPerSecond != nil {
+			p.pacedWrites, from.writes = true, 0
+		}
+		if s.Concurrency != nil {
+			from.concurrency = 0
+		}
+	}
+
+	for i, s := range cfg.Stages {
+		to := from
+		if s.ChecksPerSecond != nil {
+			to.reads = *s.ChecksPerSecond
+		}
+		if s.WritesPerSecond != nil {
+			to.writes = *s.WritesPerSecond
+		}
+		if s.Concurrency != nil {
+			to.concurrency = float64(*s.Concurrency)
+		}
+
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("stage %d", i+1)
+		}
+		d := time.Duration(s.DurationSec) * time.Second
+		p.stages = append(p.stages, stage{name: name, start: p.total, end: p.total + d, from: from, to: to})
+		p.total += d
+		p.readers = max(p.readers, int(math.Ceil(to.concurrency)))
+		from = to
+	}
+	return p, nil
+}
+
+// fromCurve builds one stage per pair of consecutive curve points, so the
+// rates follow the curve by linear interpolation. Reads or writes missing
+// from the curve keep their base setting. The series of the operations of
+// service, if any, are kept in p.ops instead.
+func (p *profile) fromCurve(c config.Curve, base target, service string) error {
+	series, err := c.Load()
+	if err != nil {
+		return err
+	}
+	for name, points := range series {
+		op, ok := config.CurveOperation(service, name)
+		if !ok {
+			continue
+		}
+		if _, dup := p.ops[op]; dup {
+			return fmt.Errorf("curve file %s sets %s operation %s twice", c.File, service, op)
+		}
+		if p.ops == nil {
+			p.ops = map[string][]config.CurvePoint{}
+		}
+		p.ops[op] = points
+	}
+
+	var offsets []time.Duration
+	seen := map[time.Duration]bool{}
+	for _, points := range series {
+		for _, pt := range points {
+			if !seen[pt.Offset] {
+				seen[pt.Offset] = true
+				offsets = append(offsets, pt.Offset)
+			}
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	if len(offsets) < 2 {
+		return fmt.Errorf("curve file %s must span at least two distinct offsets", c.File)
+	}
+
+	reads, hasReads := series["reads"]
+	writes, hasWrites := series["writes"]
+	p.pacedReads = p.pacedReads || hasReads
+	p.pacedWrites = p.pacedWrites || hasWrites
+	at := func(t time.Duration) target {
+		tg := base
+		if hasReads {
+			tg.reads = interpolate(reads, t)
+		}
+		if hasWrites {
+			tg.writes = interpolate(writes, t)
+		}
+		return tg
+	}
+
+	for i := 1; i < len(offsets); i++ {
+		p.stages = append(p.stages, stage{
+			name:  "curve",
+			start: offsets[i-1],
+			end:   offsets[i],
+			from:  at(offsets[i-1]),
+			to:    at(offsets[i]),
+		})
+	}
+	p.total = offsets[len(offsets)-1]
+	p.readers = int(base.concurrency)
+	return nil
+}
+
+// interpolate returns the rate of a sorted series at t, holding the first
+// and last values outside of it.
+func interpolate(points []config.CurvePoint, t time.Duration) float64 {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Offset >= t })
+	switch {
+	case i == 0:
+		return points[0].RPS
+	case i == len(points):
+		return points[len(points)-1].RPS
+	}
+	a, b := points[i-1], points[i]
+	frac := float64(t-a.Offset) / float64(b.Offset-a.Offset)
+	return a.RPS + (b.RPS-a.RPS)*frac
+}
+
+// stageAt returns the index of the stage running at elapsed.
+func (p *profile) stageAt(elapsed time.Duration) int {
+	i := sort.Search(len(p.stages), func(i int) bool { return elapsed < p.stages[i].end })
+	return min(i, len(p.stages)-1)
+}
+
+// at returns the interpolated target at elapsed.
+func (p *profile) at(elapsed time.Duration) target {
+	s := p.stages[p.stageAt(elapsed)]
+	frac := 1.0
+	if d := s.end - s.start; d > 0 {
+		frac = math.Min(1, math.Max(0, float64(elapsed-s.start)/float64(d)))
+	}
+	lerp := func(a, b float64) float64 { return a + (b-a)*frac }
+	return target{
+		reads:       lerp(s.from.reads, s.to.reads),
+		writes:      lerp(s.from.writes, s.to.writes),
+		concurrency: lerp(s.from.concurrency, s.to.concurrency),
+	}
+}
+
+// rateChange returns the end of the stage running at elapsed, up to which
+// the rates change linearly. It returns false once the rates no longer
+// change.
+func (p *profile) rateChange(elapsed time.Duration) (time.Duration, bool) {
+	s := p.stages[p.stageAt(elapsed)]
+	if s.end <= elapsed {
+		return 0, false
+	}
+	return s.end, true
+}
+
+// opRate returns the rate the curve sets for operation op at elapsed.
+func (p *profile) opRate(op string, elapsed time.Duration) float64 {
+	return interpolate(p.ops[op], elapsed)
+}
+
+func (p *profile) readRate(elapsed time.Duration) float64  { return p.at(elapsed).reads }
+func (p *profile) writeRate(elapsed time.Duration) float64 { return p.at(elapsed).writes }
+
+// activeReaders returns how many read workers should be running at elapsed.
+func (p *profile) activeReaders(elapsed time.Duration) int {
+	return int(math.Round(p.at(elapsed).concurrency))
+}
+
+// nextChange returns the first time after elapsed at which activeReaders
+// may return another value: the next half-way point between two worker
+// counts of a ramp, or the end of a stage. It returns false once the
+// concurrency no longer changes.
+func (p *profile) nextChange(elapsed time.Duration) (time.Duration, bool) {
+	s := p.stages[p.stageAt(elapsed)]
+	if s.end <= elapsed {
+		return 0, false
+	}
+	from, to := s.from.concurrency, s.to.concurrency
+	if from == to {
+		return s.end, true
+	}
+	n := float64(p.activeReaders(elapsed))
+	next := n + 0.5
+	if to < from {
+		next = n - 0.5
+	}
+	t := s.start + time.Duration((next-from)/(to-from)*float64(s.end-s.start))
+	// Rounding may land t at or before elapsed right on a half-way point.
+	return min(max(t, elapsed+time.Millisecond), s.end), true
+}
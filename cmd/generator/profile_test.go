@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+func TestNextChange(t *testing.T) {
+	concurrency := func(n int) *int { return &n }
+	prof, err := newProfile(config.Workload{Stages: []config.Stage{
+		{Name: "ramp-up", DurationSec: 3, Concurrency: concurrency(10)},
+		{Name: "steady", DurationSec: 2, Concurrency: concurrency(10)},
+		{Name: "ramp-down", DurationSec: 2, Concurrency: concurrency(3)},
+		{Name: "step", DurationSec: 1, Concurrency: concurrency(3)},
+	}}, "keto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Between two consecutive change points, sampled every millisecond,
+	// the concurrency must not change: otherwise the gate would miss it.
+	var elapsed time.Duration
+	changes := 0
+	for {
+		next, ok := prof.nextChange(elapsed)
+		if !ok {
+			break
+		}
+		if next <= elapsed {
+			t.Fatalf("nextChange(%v) = %v, not after it", elapsed, next)
+		}
+		n := prof.activeReaders(elapsed)
+		for at := elapsed; at < next; at += time.Millisecond {
+			if got := prof.activeReaders(at); got != n {
+				t.Fatalf("activeReaders(%v) = %d, changed from %d before nextChange(%v) = %v", at, got, n, elapsed, next)
+			}
+		}
+		if prof.activeReaders(next) != n {
+			changes++
+		}
+		elapsed = next
+	}
+	if elapsed != prof.total {
+		t.Errorf("last change at %v, want the end of the profile %v", elapsed, prof.total)
+	}
+	// 10 steps up from 0 and 7 down to 3.
+	if changes != 17 {
+		t.Errorf("concurrency changed %d times, want 17", changes)
+	}
+	if got := prof.activeReaders(prof.total + time.Hour); got != 3 {
+		t.Errorf("activeReaders after the profile = %d, want 3", got)
+	}
+}
+
+func TestCurveOperations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "curve.csv")
+	if err := os.WriteFile(file, []byte("offset,reads,keto.check,expand,grant\n0,100,400,10,5\n10,100,800,30,5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Workload{Curve: config.Curve{File: file}}
+
+	for _, tc := range []struct {
+		service string
+		ops     []string
+	}{
+		{"keto", []string{"check", "expand"}},
+		{"hydra", []string{"grant"}},
+		{"kratos", nil},
+	} {
+		prof, err := newProfile(cfg, tc.service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ops []string
+		for op := range prof.ops {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		if !slices.Equal(ops, tc.ops) {
+			t.Errorf("%s curve operations = %v, want %v", tc.service, ops, tc.ops)
+		}
+	}
+
+	prof, err := newProfile(cfg, "keto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prof.opsRate(5 * time.Second); got != 620 {
+		t.Errorf("opsRate(5s) = %g, want 620", got)
+	}
+	if got := prof.readRate(5 * time.Second); got != 100 {
+		t.Errorf("readRate(5s) = %g, want 100", got)
+	}
+}
+
+func TestPacerZeroRate(t *testing.T) {
+	rate := func(r float64) *float64 { return &r }
+	prof, err := newProfile(config.Workload{Stages: []config.Stage{
+		{Name: "idle", DurationSec: 3600, WritesPerSecond: rate(0)},
+		{Name: "ramp-up", DurationSec: 10, WritesPerSecond: rate(10)},
+		{Name: "ramp-down", DurationSec: 10, WritesPerSecond: rate(0)},
+	}}, "keto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As for an indefinite run, the pacer must skip the idle hour and give
+	// up once the rate stays at zero rather than walk to the end.
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	end := start.AddDate(100, 0, 0)
+	p := newPacer(true, start, end, prof.writeRate, prof.rateChange)
+
+	// The rate ramps up by 1/s², so the first slot accrues after √2s.
+	if got, want := p.next.Sub(start), time.Hour+1414*time.Millisecond; got < want-pacerStep || got > want+pacerStep {
+		t.Errorf("first slot at %v, want %v", got, want)
+	}
+	slots := 0
+	for at := p.next; at.Before(end); at = p.advance(at) {
+		slots++
+	}
+	// Each ramp accrues 50 slots; the last one may fall short of a slot.
+	if slots < 99 || slots > 100 {
+		t.Errorf("pacer handed out %d slots, want 99 or 100", slots)
+	}
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queue holds the entities written and not yet fully read back. Writers
+// never block on it: once depth entities are waiting, the oldest one is
+// evicted to make room. Readers block until an entity is available.
+type queue[T any] struct {
+	mu      sync.Mutex
+	items   []queued[T] // ring buffer
+	head    int
+	size    int
+	evicted int64
+	// depth reports size as it changes.
+	depth prometheus.Gauge
+	// ready holds a token while entities may be waiting; each reader
+	// taking one passes it on if any are left.
+	ready chan struct{}
+}
+
+// queued is an entity, the number of reads still due on it and when it
+// was queued.
+type queued[T any] struct {
+	entity T
+	reads  int
+	since  time.Time
+}
+
+func newQueue[T any](depth int, gauge prometheus.Gauge) *queue[T] {
+	return &queue[T]{items: make([]queued[T], depth), ready: make(chan struct{}, 1), depth: gauge}
+}
+
+// push queues e to be read reads times.
+func (q *queue[T]) push(e T, reads int) {
+	if reads <= 0 {
+		return
+	}
+	q.mu.Lock()
+	if q.size == len(q.items) {
+		q.items[q.head] = queued[T]{}
+		q.head = (q.head + 1) % len(q.items)
+		q.size--
+		q.evicted++
+	}
+	q.items[(q.head+q.size)%len(q.items)] = queued[T]{entity: e, reads: reads, since: time.Now()}
+	q.size++
+	q.depth.Set(float64(q.size))
+	q.mu.Unlock()
+	q.signal()
+}
+
+// pop blocks until an entity is due for a read and returns it with the
+// time it was queued, or returns false once done is closed.
+func (q *queue[T]) pop(done <-chan struct{}) (T, time.Time, bool) {
+	for {
+		q.mu.Lock()
+		if q.size > 0 {
+			item := &q.items[q.head]
+			e, since := item.entity, item.since
+			if item.reads--; item.reads == 0 {
+				*item = queued[T]{}
+				q.head = (q.head + 1) % len(q.items)
+				q.size--
+				q.depth.Set(float64(q.size))
+			}
+			more := q.size > 0
+			q.mu.Unlock()
+			if more {
+				q.signal()
+			}
+			return e, since, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-done:
+			var zero T
+			return zero, time.Time{}, false
+		}
+	}
+}
+
+// signal wakes up one waiting reader, if any.
+func (q *queue[T]) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// evictions returns how many entities were evicted before being fully read.
+func (q *queue[T]) evictions() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.evicted
+}
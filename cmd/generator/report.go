@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"sort"
+	"strings"
+
+	"crdb-ory-load-test/internal/report"
+	"crdb-ory-load-test/internal/stats"
+)
+
+// report converts the result of a finished run for the run report.
+func (r *result) report() *report.Service {
+	s := &report.Service{
+		Name:        r.name,
+		StartedAt:   r.start,
+		EndedAt:     r.start.Add(r.duration),
+		DurationSec: r.duration.Seconds(),
+		Concurrency: r.concurrency,
+		Reads:       r.operation("reads", r.reads.Load(), r.failedReads.Load(), r.readLatency),
+		Writes:      r.operation("writes", r.writes.Load()+r.failedWrites.Load(), r.failedWrites.Load(), r.writeLatency),
+		Positive:    r.positive.Load(),
+		Negative:    r.negative.Load(),
+		Evicted:     r.evicted.Load(),
+		Intervals:   r.intervals,
+		Aborted:     r.aborted,
+	}
+	s.Reads.TargetRate, s.Writes.TargetRate = r.targetReadRate, r.targetWriteRate
+
+	names := make([]string, 0, len(r.ops))
+	for name := range r.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if o := r.ops[name]; o.count.Load() > 0 {
+			s.Operations = append(s.Operations, r.operation(name, o.count.Load(), o.failed.Load(), o.latency))
+		}
+	}
+
+	service := strings.ToLower(r.name)
+	for _, name := range stats.Calls.Names(service) {
+		h := stats.Calls.Histogram(service, name)
+		s.Calls = append(s.Calls, report.Call{
+			Name:       name,
+			Count:      h.Count(),
+			Throughput: r.rate(h.Count()),
+			Statuses:   stats.Calls.Statuses(service, name),
+			Latency:    report.NewLatency(h),
+		})
+	}
+
+	for _, st := range r.stages {
+		s.Stages = append(s.Stages, report.Stage{
+			Name:         st.name,
+			StartSec:     st.start.Seconds(),
+			EndSec:       st.end.Seconds(),
+			Reads:        st.reads.Load(),
+			Writes:       st.writes.Load(),
+			FailedReads:  st.failedReads.Load(),
+			FailedWrites: st.failedWrites.Load(),
+			ReadLatency:  report.NewLatency(st.readLatency.response),
+		})
+	}
+	return s
+}
+
+func (r *result) operation(name string, count, failed int64, l latency) report.Operation {
+	return report.Operation{
+		Name:         name,
+		Count:        count,
+		Failed:       failed,
+		Throughput:   r.rate(count),
+		ServiceTime:  report.NewLatency(l.service),
+		ResponseTime: report.NewLatency(l.response),
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"crdb-ory-load-test/internal/report"
+)
+
+// runHTMLReport implements `crdb-ory-load-test html-report run.json`,
+// rendering a JSON report written by an earlier run. It returns the
+// process exit code: 0 on success and 1 otherwise.
+func runHTMLReport(args []string) int {
+	fs := flag.NewFlagSet("html-report", flag.ExitOnError)
+	out := fs.String("o", "", "Path of the HTML report (default: the JSON report's path with an .html extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: crdb-ory-load-test html-report [-o report.html] run.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	r, err := report.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	path := *out
+	if path == "" {
+		path = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + ".html"
+	}
+	if err := r.WriteHTML(path); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("📈 HTML report written to %s\n", path)
+	return 0
+}
@@ -1,29 +1,69 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+
 	"crdb-ory-load-test/cmd/generator"
 	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
+	"crdb-ory-load-test/internal/health"
+	"crdb-ory-load-test/internal/logging"
 	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/report"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(runCompare(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "html-report" {
+		os.Exit(runHTMLReport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "receiver" {
+		os.Exit(runReceiver(os.Args[2:]))
+	}
+
 	scope := flag.String("scope", "all", "Scope of Workload Simulation (valid values: hydra, kratos, keto, all)")
 	duration := flag.Int("duration-sec", 0, "Override duration in seconds")
     readRatio := flag.Int("read-ratio", 0, "Override read/write ratio (e.g. 100 = 100:1)")
+	checksPerSecond := flag.Float64("checks-per-second", 0, "Override target read (check) rate per second")
+	writesPerSecond := flag.Float64("writes-per-second", 0, "Override target write rate per second")
+	parallel := flag.Bool("parallel", false, "Run Hydra, Kratos and Keto at the same time under -scope=all")
 	dryRun := flag.Bool("dry-run", false, "Simulate workload without API calls")
 	workloadConfig := flag.String("workload-config", "config/config.yaml", "Path to workload config")
 	logFile := flag.String("log-file", "", "Path to log output file")
 	serveMetrics := flag.Bool("serve-metrics", false, "Keep Prometheus metrics endpoint alive after run")
+	metricsAddress := flag.String("metrics-address", "", "Listen address of the Prometheus metrics endpoint (default 0.0.0.0:2112)")
+	intervalSec := flag.Int("interval-sec", 0, "Print a status line every N seconds (0 disables)")
+	intervalFile := flag.String("interval-file", "", "Also write the interval samples to this file as NDJSON")
+	junitFile := flag.String("junit-file", "", "Write the threshold results to this file as JUnit XML")
+	reportFile := flag.String("report-file", "", "Write a JSON (or CSV, for a .csv path) run report to this file")
+	htmlReport := flag.String("html-report", "", "Write a self-contained HTML report with charts to this file")
+	eventsFile := flag.String("events-file", "", "Record every Ory request to this file as NDJSON")
+	eventsSample := flag.Float64("events-sample", 1, "Fraction of the Ory requests recorded to -events-file, between 0 and 1")
 	verbose := flag.Bool("verbose", true, "Enable verbose logging")
+	logLevel := flag.String("log-level", "info", "Minimum level logged: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	logRate := flag.Int("log-rate", 10, "Log at most N lines per second for each Ory operation and level (0 disables the limit)")
+	var overrides, labels keyValueFlag
+	flag.Var(&labels, "label", "Label the run's metrics and report, e.g. -label crdb_version=24.1 (repeatable)")
+	flag.Var(&overrides, "set", "Override a config setting, e.g. -set keto.read_api=http://localhost:4466 (repeatable)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), `
@@ -31,18 +71,40 @@ func main() {
 
 Usage:
   ./crdb-ory-load-test [flags]
+  ./crdb-ory-load-test validate [-workload-config path] [-scope scope] [-set key=value]
+  ./crdb-ory-load-test compare [-max-throughput-drop pct] [-max-latency-increase pct] baseline.json candidate.json
+  ./crdb-ory-load-test html-report [-o report.html] run.json
+  ./crdb-ory-load-test receiver [-address 127.0.0.1:9091]
 
 Options:
   -scope               Scope of Workload Simulation (valid values: hydra, kratos, keto. Default: all)
-  -checks-per-second   Max permission checks per second (overrides config file)
+  -checks-per-second   Target reads (checks) per second, issued on a fixed schedule (overrides config file)
+  -writes-per-second   Target writes per second, issued on a fixed schedule (overrides config file)
   -duration-sec        Run for this many seconds (default from config file)
   -read-ratio          Read-to-write ratio (e.g. 100 means 100 reads per 1 write)
   -workload-config     Path to workload config file (default: config/config.yaml)
+  -set key=value       Override any config setting by its YAML path (repeatable)
+  -label key=value     Label every metric and the run report, e.g. -label topology=3-region (repeatable)
   -log-file            Path to write logs to (default: stdout only)
+  -log-level           Minimum level logged: debug (every operation), info, warn or error (default: info)
+  -log-format          Log format, text or json (default: text)
+  -log-rate            Log at most N lines per second for each Ory operation, counting the rest as suppressed (default: 10, 0 disables)
   -serve-metrics       Keep Prometheus metrics endpoint alive after run (default: false)
+  -metrics-address     Listen address of the metrics endpoint (default: 0.0.0.0:2112, port 0 picks a free one)
+  -interval-sec        Print per-operation throughput, errors and latency every N seconds (0 disables)
+  -interval-file       Also append each interval sample to this file as NDJSON
+  -junit-file          Write the results of the config's thresholds as JUnit XML
+  -report-file         Write a machine-readable run report, as CSV if the path ends in .csv, JSON otherwise
+  -html-report         Write a self-contained HTML report with throughput, latency and error charts
+  -events-file         Record one JSON line per Ory request (status, latency, worker, attempt, entities)
+  -events-sample       Record only this fraction of the requests to -events-file (default: 1, all of them)
+  -parallel            Run Hydra, Kratos and Keto concurrently under -scope=all (default: one after the other)
   -dry-run             Skip actual writes and permission checks
   -help                Show this help message
 
+⚖️  Settings are resolved as: config file < CRDB_ORY_* environment < flags.
+   Values in the file may use ${VAR}, ${VAR:-default} and ${file:/path/to/secret}.
+
 🔒 This tool assumes Ory + CockroachDB Sandbox is deployed and reachable.
 📖 See install docs: https://github.com/amineelkouhen/crdb-ory-sandbox/?tab=readme-ov-file#-deployment
 `)
@@ -59,13 +121,39 @@ Options:
 		log.Fatalf("❌ Failed to load config: %v", err)
 	}
 
-    if *duration > 0 {
-        config.AppConfig.Workload.DurationSec = *duration
-    }
-	if *readRatio > 0 {
+	if err := applyOverrides(overrides); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	applyLabels(labels)
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "duration-sec":
+			config.AppConfig.Workload.DurationSec = *duration
+		case "read-ratio":
 		config.AppConfig.Workload.ReadRatio = *readRatio
+		case "checks-per-second":
+			config.AppConfig.Workload.ChecksPerSecond = *checksPerSecond
+		case "writes-per-second":
+			config.AppConfig.Workload.WritesPerSecond = *writesPerSecond
+		case "parallel":
+			config.AppConfig.Workload.Parallel = *parallel
+		case "interval-sec":
+			config.AppConfig.Workload.IntervalSec = *intervalSec
+		case "metrics-address":
+			config.AppConfig.Metrics.Address = *metricsAddress
+	}
+	})
+
+	if *eventsSample <= 0 || *eventsSample > 1 {
+		log.Fatalf("❌ -events-sample must be greater than 0 and at most 1, got %v", *eventsSample)
+	}
+
+	if err := config.Validate(*scope); err != nil {
+		log.Fatalf("❌ Invalid config: %v\n💡 Run `crdb-ory-load-test validate` for details.", err)
 	}
 
+	var logOutput io.Writer = os.Stderr
 	if *logFile != "" {
 		f, err := os.Create(*logFile)
 		if err != nil {
@@ -74,52 +162,153 @@ Options:
 		defer f.Close()
 
 		if *verbose {
-			log.SetOutput(io.MultiWriter(os.Stdout, f))
+			logOutput = io.MultiWriter(os.Stdout, f)
 		} else {
-			log.SetOutput(f)
+			logOutput = f
 		}
 	} else if !*verbose {
-		log.SetOutput(io.Discard)
+		logOutput = io.Discard
+	}
+	if _, err := logging.Setup(logOutput, logging.Options{Level: *logLevel, Format: *logFormat, Rate: *logRate}); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if *intervalFile != "" {
+		f, err := os.Create(*intervalFile)
+		if err != nil {
+			log.Fatalf("❌ Failed to create interval file: %v", err)
+		}
+		defer f.Close()
+		generator.SetIntervalOutput(f)
+	}
+
+	ctx := handleSignals()
+
+	runID := newRunID()
+	logRun(runID)
+	metricsServer, err := metrics.Start(strings.ToLower(*scope), config.AppConfig.Metrics, runLabels(runID))
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	pusher := metrics.StartPush(metricsServer.Registry, config.AppConfig.Metrics.Push, runID)
+	ctx = metrics.With(ctx, metricsServer.Collectors)
+
+	var recorder *events.Writer
+	if *eventsFile != "" && !*dryRun {
+		recorder, err = events.Start(*eventsFile, runID, *eventsSample)
+		if err != nil {
+			log.Fatalf("❌ Failed to create events file: %v", err)
+		}
 	}
 
+	start := time.Now()
+	var services []*report.Service
     switch strings.ToLower(*scope) {
         case "hydra":
             if !*dryRun {
                 checkHydra()
             }
-            metrics.Init("hydra")
-            generator.RunHydraWorkload(*dryRun)
+		services = append(services, generator.RunHydraWorkload(ctx, *dryRun))
         case "kratos":
             if !*dryRun {
                 checkKratos()
             }
-            metrics.Init("kratos")
-            generator.RunKratosWorkload(*dryRun)
+		services = append(services, generator.RunKratosWorkload(ctx, *dryRun))
         case "keto":
             if !*dryRun {
                 checkKeto()
             }
-            metrics.Init("keto")
-            generator.RunKetoWorkload(*dryRun)
+		services = append(services, generator.RunKetoWorkload(ctx, *dryRun))
         default:
             if !*dryRun {
                 checkHydra()
                 checkKratos()
                 checkKeto()
             }
-            metrics.Init("all")
-            generator.RunHydraWorkload(*dryRun)
-            generator.RunKratosWorkload(*dryRun)
-            generator.RunKetoWorkload(*dryRun)
+		if config.AppConfig.Workload.Parallel {
+			services = generator.RunParallelWorkloads(ctx, *dryRun)
+		} else {
+			services = append(services,
+				generator.RunHydraWorkload(ctx, *dryRun),
+				generator.RunKratosWorkload(ctx, *dryRun),
+				generator.RunKetoWorkload(ctx, *dryRun))
+	}
+	}
+
+	if n := logging.Suppressed(); n > 0 {
+		log.Printf("🔇 %d per-operation log lines suppressed by -log-rate %d", n, *logRate)
+	}
+	pusher.Stop()
+	if err := recorder.Close(); err != nil {
+		slog.Error("❌ Failed to write events file", "error", err)
 	}
 
-	if *serveMetrics {
-		fmt.Println("📊 Prometheus metrics available at http://localhost:2112/metrics")
-		fmt.Println("🔁 Waiting indefinitely for Prometheus to scrape. Ctrl+C to exit.")
-		select {}
+	rep := newReport(runID, strings.ToLower(*scope), *dryRun, start, services)
+	logThresholds(rep.Thresholds)
+	if *reportFile != "" {
+		writeReport(*reportFile, rep)
+	}
+	if *htmlReport != "" {
+		writeHTMLReport(*htmlReport, rep)
+	}
+	if *junitFile != "" {
+		if err := report.WriteJUnit(*junitFile, rep.Thresholds); err != nil {
+			slog.Error("❌ Failed to write the JUnit report", "error", err)
+		}
+	}
+
+	if *serveMetrics && metricsServer.URL != "" {
+		log.Printf("📊 Prometheus metrics available at %s", metricsServer.URL)
+		log.Println("🔁 Waiting indefinitely for Prometheus to scrape. Ctrl+C to exit.")
+		<-ctx.Done()
+	}
+	shutdownMetrics(metricsServer)
+
+	if names := aborted(rep); len(names) > 0 {
+		log.Printf("🧯 %s aborted by the circuit breaker, exiting with code %d", strings.Join(names, ", "), exitAborted)
+		os.Exit(exitAborted)
+	}
+	if !report.Passed(rep.Thresholds) {
+		slog.Error("❌ Thresholds breached", "exit_code", exitThresholdsFailed)
+		os.Exit(exitThresholdsFailed)
+	}
+}
+
+// newRunID returns an identifier for the run, sortable by start time, e.g.
+// 20250601-100000-3fa2.
+func newRunID() string {
+	return time.Now().UTC().Format("20060102-150405") + "-" + uuid.NewString()[:4]
+}
+
+// shutdownMetrics stops the metrics server, giving in-flight scrapes a few
+// seconds to complete.
+func shutdownMetrics(s *metrics.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		slog.Warn("⚠️  Failed to stop the metrics server", "error", err)
 	}
 }
 
+// handleSignals returns a context cancelled on the first SIGINT or SIGTERM,
+// which lets the workloads drain in-flight requests and print their
+// summary. A second signal exits immediately.
+func handleSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		log.Printf("🛑 Received %v, draining in-flight requests. Press Ctrl+C again to force exit.", sig)
+		cancel()
+		<-sigs
+		log.Println("💥 Forced exit")
+		os.Exit(130)
+	}()
+	return ctx
+}
+
 func checkHydra(){
     if config.AppConfig.Hydra.AdminAPI == nil {
         log.Fatalf("❌ Hydra Admin Endpoint is Missing")
@@ -130,10 +319,8 @@ func checkHydra(){
         os.Exit(-1)
     }
 
-    healthURL := *config.AppConfig.Hydra.AdminAPI + "/health/alive"
-    client := http.Client{Timeout: 3 * time.Second}
-    resp, err := client.Get(healthURL)
-    if err != nil || resp.StatusCode != 200 {
+	status, err := health.Alive(*config.AppConfig.Hydra.AdminAPI)
+	if err != nil {
         log.Fatalf(`❌ Unable to reach Ory Hydra at %s.
 
         Make sure Ory Hydra is running and reachable.
@@ -142,7 +329,7 @@ func checkHydra(){
         Details:
         - Error: %v
         - HTTP Status: %v
-        `, config.AppConfig.Hydra.AdminAPI, err, resp.StatusCode)
+        `, *config.AppConfig.Hydra.AdminAPI, err, status)
     }
 }
 
@@ -156,10 +343,8 @@ func checkKratos(){
         os.Exit(-1)
     }
 
-    healthURL := *config.AppConfig.Kratos.AdminAPI + "/health/alive"
-    client := http.Client{Timeout: 3 * time.Second}
-    resp, err := client.Get(healthURL)
-    if err != nil || resp.StatusCode != 200 {
+	status, err := health.Alive(*config.AppConfig.Kratos.AdminAPI)
+	if err != nil {
         log.Fatalf(`❌ Unable to reach Ory Kratos at %s.
 
         Make sure Ory Kratos is running and reachable.
@@ -168,7 +353,7 @@ func checkKratos(){
         Details:
         - Error: %v
         - HTTP Status: %v
-        `, config.AppConfig.Kratos.AdminAPI, err, resp.StatusCode)
+        `, *config.AppConfig.Kratos.AdminAPI, err, status)
     }
 }
 
@@ -182,10 +367,8 @@ func checkKeto(){
         os.Exit(-1)
     }
 
-    healthURL := *config.AppConfig.Keto.ReadAPI + "/health/alive"
-    client := http.Client{Timeout: 3 * time.Second}
-    resp, err := client.Get(healthURL)
-    if err != nil || resp.StatusCode != 200 {
+	status, err := health.Alive(*config.AppConfig.Keto.ReadAPI)
+	if err != nil {
         log.Fatalf(`❌ Unable to reach Ory Keto at %s.
 
         Make sure Ory Keto is running and reachable.
@@ -194,6 +377,69 @@ func checkKeto(){
         Details:
         - Error: %v
         - HTTP Status: %v
-        `, config.AppConfig.Keto.ReadAPI, err, resp.StatusCode)
+        `, *config.AppConfig.Keto.ReadAPI, err, status)
     }
-}
\ No newline at end of file
+}
+
+func applyOverrides(overrides keyValueFlag) error {
+	for _, kv := range overrides {
+		key, value, _ := strings.Cut(kv, "=")
+		if err := config.Set(key, value); err != nil {
+			return fmt.Errorf("invalid -set override: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyLabels adds the -label flags to the labels of the config file.
+func applyLabels(labels keyValueFlag) {
+	for _, kv := range labels {
+		name, value, _ := strings.Cut(kv, "=")
+		if config.AppConfig.Labels == nil {
+			config.AppConfig.Labels = map[string]string{}
+		}
+		config.AppConfig.Labels[name] = value
+	}
+}
+
+// runLabels returns the labels of every metric of the run.
+func runLabels(runID string) map[string]string {
+	labels := map[string]string{"run_id": runID}
+	for name, value := range config.AppConfig.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// logRun prints the run ID and labels, so that the log of a run can be
+// matched with its metrics and report.
+func logRun(runID string) {
+	names := make([]string, 0, len(config.AppConfig.Labels))
+	for name := range config.AppConfig.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + config.AppConfig.Labels[name]
+	}
+	if len(names) == 0 {
+		log.Printf("🏷️  Run %s", runID)
+		return
+	}
+	log.Printf("🏷️  Run %s (%s)", runID, strings.Join(names, ", "))
+}
+
+// keyValueFlag collects repeated key=value flags.
+type keyValueFlag []string
+
+func (k *keyValueFlag) String() string {
+	return strings.Join(*k, ",")
+}
+
+func (k *keyValueFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	*k = append(*k, v)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"crdb-ory-load-test/internal/metrics"
+)
+
+// runReceiver implements `crdb-ory-load-test receiver`: a local stand-in
+// for a Pushgateway and a remote-write endpoint, to check the pushes of a
+// run without Prometheus. On SIGINT or SIGTERM it prints the latest value
+// of every series received and exits with code 0, or 1 when nothing was
+// received.
+func runReceiver(args []string) int {
+	fs := flag.NewFlagSet("receiver", flag.ExitOnError)
+	address := fs.String("address", "127.0.0.1:9091", "Listen address")
+	filter := fs.String("match", "", "Only print the series whose name contains this string")
+	fs.Parse(args)
+
+	r, err := metrics.NewReceiver(*address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("📥 Receiving pushes on %s (remote write: %s/api/v1/write). Ctrl+C to print them and exit.\n", r.URL, r.URL)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	r.Close()
+
+	samples := r.Samples()
+	fmt.Printf("\n📥 %d push(es), %d series\n", r.Pushes(), len(samples))
+	for _, s := range samples {
+		if *filter != "" && !strings.Contains(s.Name, *filter) {
+			continue
+		}
+		fmt.Println(s)
+	}
+	if r.Pushes() == 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"time"
+
+	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/report"
+)
+
+// Exit codes of a run that completed without error but did not pass.
+const (
+	// exitThresholdsFailed is the exit code of a run breaching a threshold.
+	exitThresholdsFailed = 3
+	// exitAborted is the exit code of a run aborted by the circuit breaker.
+	exitAborted = 4
+)
+
+// aborted returns the services of r aborted by the circuit breaker.
+func aborted(r *report.Report) []string {
+	var names []string
+	for _, s := range r.Services {
+		if s.Aborted != "" {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// newReport gathers the outcome of the run, with its thresholds checked.
+func newReport(runID, scope string, dryRun bool, start time.Time, services []*report.Service) *report.Report {
+	cfg, err := config.Snapshot()
+	if err != nil {
+		slog.Warn("⚠️  Failed to include the config in the report", "error", err)
+	}
+
+	end := time.Now()
+	r := &report.Report{
+		SchemaVersion: report.SchemaVersion,
+		RunID:         runID,
+		Labels:        config.AppConfig.Labels,
+		Scope:         scope,
+		DryRun:        dryRun,
+		StartedAt:     start,
+		EndedAt:       end,
+		DurationSec:   end.Sub(start).Seconds(),
+		Config:        cfg,
+		Services:      []report.Service{},
+	}
+	for _, s := range services {
+		if s != nil {
+			r.Services = append(r.Services, *s)
+		}
+	}
+	r.Thresholds = report.Evaluate(config.AppConfig.Thresholds, scope, dryRun, r.Services)
+	return r
+}
+
+// writeReport writes the run report to path, logging rather than failing
+// the run when it cannot.
+func writeReport(path string, r *report.Report) {
+	if err := r.WriteFile(path); err != nil {
+		slog.Error("❌ Failed to write the run report", "error", err)
+		return
+	}
+	log.Printf("📝 Run report written to %s", path)
+}
+
+// writeHTMLReport writes the run report to path as HTML, logging rather
+// than failing the run when it cannot.
+func writeHTMLReport(path string, r *report.Report) {
+	if err := r.WriteHTML(path); err != nil {
+		slog.Error("❌ Failed to write the HTML report", "error", err)
+		return
+	}
+	log.Printf("📈 HTML report written to %s", path)
+}
+
+// logThresholds prints a pass, fail or skip line per threshold.
+func logThresholds(checks []report.Check) {
+	if len(checks) == 0 {
+		return
+	}
+	log.Println("🚦 Thresholds:")
+	for _, c := range checks {
+		switch {
+		case c.Skipped:
+			log.Printf("   ⏭️  SKIP  %-40s %s", c.Threshold, c.Reason)
+		case c.Passed:
+			log.Printf("   ✅ PASS  %-40s %.3f", c.Threshold, c.Value)
+		default:
+			log.Printf("   ❌ FAIL  %-40s %s", c.Threshold, c.Reason)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+// runValidate implements `crdb-ory-load-test validate`. It returns the
+// process exit code: 0 when the config is valid, 1 otherwise.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	scope := fs.String("scope", "all", "Scope the config must support (valid values: hydra, kratos, keto, all)")
+	workloadConfig := fs.String("workload-config", "config/config.yaml", "Path to workload config")
+	var overrides keyValueFlag
+	fs.Var(&overrides, "set", "Override a config setting before validating (repeatable)")
+	fs.Parse(args)
+
+	if err := config.LoadConfig(*workloadConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	if err := applyOverrides(overrides); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	err := config.Validate(*scope)
+	var problems config.ValidationError
+	if errors.As(err, &problems) {
+		fmt.Fprintf(os.Stderr, "❌ %s is invalid for scope %s:\n", *workloadConfig, *scope)
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", p)
+		}
+		return 1
+	}
+
+	fmt.Printf("✅ %s is valid for scope %s\n", *workloadConfig, *scope)
+	return 0
+}
@@ -3,43 +3,491 @@ package config
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Hydra struct {
-		AdminAPI *string `yaml:"admin_api",omitempty`
-		PublicAPI  *string `yaml:"public_api",omitempty`
+		AdminAPI  *string `yaml:"admin_api,omitempty"`
+		PublicAPI *string `yaml:"public_api,omitempty"`
+		// Operations holds the weights of an operation mix, e.g. {introspect: 90, grant: 10}.
+		Operations map[string]float64 `yaml:"operations,omitempty"`
 	} `yaml:"hydra"`
 
 	Kratos struct {
-		AdminAPI *string `yaml:"admin_api",omitempty`
-		PublicAPI  *string `yaml:"public_api",omitempty`
+		AdminAPI  *string `yaml:"admin_api,omitempty"`
+		PublicAPI *string `yaml:"public_api,omitempty"`
+		// Operations holds the weights of an operation mix, e.g. {check: 80, register: 20}.
+		Operations map[string]float64 `yaml:"operations,omitempty"`
 	} `yaml:"kratos"`
 
 	Keto struct {
-		WriteAPI *string `yaml:"write_api",omitempty`
-		ReadAPI  *string `yaml:"read_api",omitempty`
+		WriteAPI *string `yaml:"write_api,omitempty"`
+		ReadAPI  *string `yaml:"read_api,omitempty"`
+		// Operations holds the weights of an operation mix, e.g. {check: 70, expand: 10, write: 15, delete: 5}.
+		Operations map[string]float64 `yaml:"operations,omitempty"`
 	} `yaml:"keto"`
 
-	Workload struct {
-		ReadRatio       int `yaml:"read_ratio"`
-        DurationSec     int `yaml:"duration_sec"`
-	} `yaml:"workload"`
+	Workload Workload `yaml:"workload"`
+
+	Metrics Metrics `yaml:"metrics"`
+
+	HTTP HTTP `yaml:"http"`
+
+	// Labels describe the run, e.g. {crdb_version: "24.1"}. They are added
+	// to every metric and to the run report, to tell runs apart.
+	Labels map[string]string `yaml:"labels"`
+
+	// Thresholds are checked at the end of the run; a breach makes the
+	// run fail.
+	Thresholds []Threshold `yaml:"thresholds"`
+}
+
+// Metrics configures the Prometheus metrics endpoint of a run.
+type Metrics struct {
+	// Enabled serves the endpoint. It defaults to true.
+	Enabled *bool `yaml:"enabled"`
+	// Address is the host:port to listen on. It defaults to 0.0.0.0:2112;
+	// port 0 picks a free port.
+	Address string `yaml:"address"`
+	// Path is the path of the endpoint. It defaults to /metrics.
+	Path string `yaml:"path"`
+	// Push sends the metrics to Prometheus, for runs too short to be
+	// scraped.
+	Push MetricsPush `yaml:"push"`
+}
+
+// MetricsPush sends the metrics of a run, labelled with its run ID, to a
+// Pushgateway, a Prometheus remote-write endpoint or both.
+type MetricsPush struct {
+	// Pushgateway is the base URL of a Pushgateway, e.g.
+	// http://localhost:9091.
+	Pushgateway string `yaml:"pushgateway"`
+	// RemoteWrite is the URL of a remote-write endpoint, e.g.
+	// http://localhost:9090/api/v1/write.
+	RemoteWrite string `yaml:"remote_write"`
+	// IntervalSec also pushes every so many seconds during the run; the
+	// final values are always pushed at the end.
+	IntervalSec int `yaml:"interval_sec"`
+	// Job is the job label of the metrics. It defaults to
+	// crdb-ory-load-test.
+	Job string `yaml:"job"`
+}
+
+// HTTP tunes the connection pool and timeouts shared by the Ory clients.
+// Settings left at 0 use the defaults of the httpclient package.
+type HTTP struct {
+	// MaxIdleConns bounds the idle connections kept across all hosts; 0
+	// means no limit.
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// MaxIdleConnsPerHost bounds the idle connections kept per host. It
+	// defaults to 1024, enough for every worker to reuse its connection.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// MaxConnsPerHost bounds the connections per host, idle or not; 0
+	// means no limit.
+	MaxConnsPerHost int `yaml:"max_conns_per_host"`
+	// IdleConnTimeoutSec closes connections idle for that long. It
+	// defaults to 90.
+	IdleConnTimeoutSec int `yaml:"idle_conn_timeout_sec"`
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool `yaml:"disable_keep_alives"`
+	// DialTimeoutMs bounds the time to open a TCP connection. It defaults
+	// to 5000.
+	DialTimeoutMs int `yaml:"dial_timeout_ms"`
+	// KeepAliveSec is the interval of TCP keep-alive probes. It defaults
+	// to 30; -1 disables them.
+	KeepAliveSec int `yaml:"keep_alive_sec"`
+	// TimeoutMs bounds every request, unless set per operation in
+	// Timeouts.
+	TimeoutMs int `yaml:"timeout_ms"`
+	// Timeouts bounds the requests of single operations, in milliseconds.
+	Timeouts Timeouts `yaml:"timeouts_ms"`
+}
+
+// Timeouts holds the request timeouts of each Ory API call, in
+// milliseconds; 0 leaves the call to http.timeout_ms or its default.
+type Timeouts struct {
+	Hydra struct {
+		CreateClient int `yaml:"create_client"`
+		Grant        int `yaml:"grant"`
+		Introspect   int `yaml:"introspect"`
+	} `yaml:"hydra"`
+	Kratos struct {
+		RegistrationFlow int `yaml:"registration_flow"`
+		Registration     int `yaml:"registration"`
+		IdentityLookup   int `yaml:"identity_lookup"`
+	} `yaml:"kratos"`
+	Keto struct {
+		Check  int `yaml:"check"`
+		Write  int `yaml:"write"`
+		Expand int `yaml:"expand"`
+		Delete int `yaml:"delete"`
+	} `yaml:"keto"`
+}
+
+// Of returns the timeout configured for the given call, e.g.
+// Of("keto", "check"), or 0 when there is none.
+func (t Timeouts) Of(service, call string) int {
+	v, ok := lookup(reflect.ValueOf(t), []string{service, call})
+	if !ok {
+		return 0
+	}
+	return int(v.Int())
+}
+
+type Workload struct {
+	ReadRatio int `yaml:"read_ratio"`
+	// Concurrency sets the number of read workers, or of workers running an
+	// operation mix. It defaults to 100.
+	Concurrency int `yaml:"concurrency"`
+	// Writers sets the number of write workers. It defaults to 1.
+	Writers int `yaml:"writers"`
+	// QueueDepth bounds the entities waiting to be read back; once full,
+	// writes evict the oldest. It defaults to 10000.
+	QueueDepth      int     `yaml:"queue_depth"`
+	DurationSec     int     `yaml:"duration_sec"`
+	ChecksPerSecond float64 `yaml:"checks_per_second"`
+	WritesPerSecond float64 `yaml:"writes_per_second"`
+	Stages          []Stage `yaml:"stages"`
+	Curve           Curve   `yaml:"curve"`
+	// IntervalSec prints a status line every so many seconds of a run; 0
+	// disables it.
+	IntervalSec int `yaml:"interval_sec"`
+	// CircuitBreaker stops a run against a failing service.
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"`
+	// Parallel runs the services of -scope=all at the same time instead of
+	// one after the other.
+	Parallel bool `yaml:"parallel"`
+}
+
+// CircuitBreaker trips when the error rate of a service over a sliding
+// window exceeds a budget, then either aborts the run or pauses it until
+// the service's /health/alive endpoint answers again.
+type CircuitBreaker struct {
+	// ErrorRate is the budget in percent; 0 disables the breaker.
+	ErrorRate float64 `yaml:"error_rate"`
+	// WindowSec is the length of the sliding window. It defaults to 10.
+	WindowSec int `yaml:"window_sec"`
+	// MinRequests is the number of operations the window needs before the
+	// breaker may trip. It defaults to 20.
+	MinRequests int `yaml:"min_requests"`
+	// Action is "abort" (default) or "pause".
+	Action string `yaml:"action"`
+	// ProbeIntervalSec is the time between health probes while paused. It
+	// defaults to 5.
+	ProbeIntervalSec int `yaml:"probe_interval_sec"`
+}
+
+// Stage is one step of a multi-stage load profile. Each target is reached
+// linearly by the end of the stage, starting from the previous stage's
+// target (or zero for the first stage); a target left out holds the
+// previous value.
+type Stage struct {
+	Name            string   `yaml:"name"`
+	DurationSec     int      `yaml:"duration_sec"`
+	ChecksPerSecond *float64 `yaml:"checks_per_second"`
+	WritesPerSecond *float64 `yaml:"writes_per_second"`
+	Concurrency     *int     `yaml:"concurrency"`
 }
 
 var AppConfig Config
 
+// Operations lists the operations each service supports in an operation mix.
+var Operations = map[string][]string{
+	"hydra":  {"grant", "introspect"},
+	"kratos": {"register", "check"},
+	"keto":   {"write", "check", "expand", "delete"},
+}
+
+// EnvPrefix is prepended to the upper-cased key path of a setting to build
+// its environment override, e.g. workload.read_ratio -> CRDB_ORY_WORKLOAD_READ_RATIO.
+// Appending _FILE to that name reads the value from the named file instead.
+const EnvPrefix = "CRDB_ORY_"
+
+// placeholder matches ${VAR}, ${VAR:-default} and ${file:/path/to/secret}.
+var placeholder = regexp.MustCompile(`\$\{(file:[^}]+|[A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// LoadConfig reads the YAML file at path into AppConfig. Placeholders in
+// values are expanded first, then CRDB_ORY_* environment variables are
+// applied on top. Command-line flags are applied afterwards by the caller
+// through Set, giving the precedence: file < environment < flags.
 func LoadConfig(path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if err := yaml.Unmarshal(data, &AppConfig); err != nil {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	if err := expandNode(&doc); err != nil {
+		return err
+	}
+	index(&doc)
+
+	var cfg Config
+	if err := doc.Decode(&cfg); err != nil {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := applyEnv(&cfg); err != nil {
+		return err
+	}
+
+	AppConfig = cfg
+	return nil
+}
+
+// Set overrides a single setting addressed by its dotted YAML key path
+// (e.g. "keto.read_api" or "workload.duration_sec"). Maps and lists, such
+// as keto.operations or thresholds, take a YAML flow value replacing the
+// whole setting, e.g. {check: 70, write: 30}.
+func Set(key, value string) error {
+	path := strings.Split(key, ".")
+	f, ok := lookup(reflect.ValueOf(&AppConfig).Elem(), path)
+	if !ok {
+		return fmt.Errorf("unknown config key %q (expected one of %s)", key, strings.Join(expectedKeys(path), ", "))
+	}
+	if err := assign(f, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	return nil
+}
+
+// expectedKeys lists the keys of the deepest section of path that exists,
+// e.g. keto.write_api, keto.read_api and keto.operations for keto.read, to
+// suggest in place of an unknown key.
+func expectedKeys(path []string) []string {
+	t, prefix := reflect.TypeOf(Config{}), ""
+	for _, key := range path[:len(path)-1] {
+		f, ok := fieldByKey(t, key)
+		if !ok || f.Type.Kind() != reflect.Struct {
+			break
+		}
+		t, prefix = f.Type, prefix+key+"."
+	}
+	keys := fieldKeys(t)
+	for i, key := range keys {
+		keys[i] = prefix + key
+	}
+	return keys
+}
+
+// Snapshot returns AppConfig as a generic map keyed as in the config file,
+// e.g. for the run report.
+func Snapshot() (map[string]any, error) {
+	data, err := yaml.Marshal(AppConfig)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EnvName returns the environment variable overriding the given key path.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func expandNode(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		v, err := expand(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = v
+		return nil
+	}
+	for _, c := range n.Content {
+		if err := expandNode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expand(s string) (string, error) {
+	var firstErr error
+	out := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		sub := placeholder.FindStringSubmatch(m)
+		name, hasDefault, def := sub[1], sub[2] != "", sub[3]
+
+		if path, ok := strings.CutPrefix(name, "file:"); ok {
+			v, err := readSecret(path)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			return v
+		}
+
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			return v
+		}
+		if hasDefault {
+			return def
+		}
+		return ""
+	})
+	return out, firstErr
+}
+
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func applyEnv(cfg *Config) error {
+	var firstErr error
+	walk(reflect.ValueOf(cfg).Elem(), nil, func(path []string, f reflect.Value) {
+		if firstErr != nil {
+			return
+		}
+		name := EnvName(strings.Join(path, "."))
+
+		value, ok := os.LookupEnv(name)
+		if file, isSet := os.LookupEnv(name + "_FILE"); isSet {
+			v, err := readSecret(file)
+			if err != nil {
+				firstErr = fmt.Errorf("%s_FILE: %w", name, err)
+				return
+			}
+			value, ok = v, true
+		}
+		if !ok {
+			return
+		}
+		if err := assign(f, value); err != nil {
+			firstErr = fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	})
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// Unset placeholders leave empty endpoints behind; treat them as missing.
+	walk(reflect.ValueOf(cfg).Elem(), nil, func(_ []string, f reflect.Value) {
+		if f.Kind() == reflect.Pointer && !f.IsNil() && f.Elem().Kind() == reflect.String && f.Elem().String() == "" {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	})
+	return nil
+}
+
+// walk calls fn for every setting of v, scalar, map or list, along with its
+// YAML key path.
+func walk(v reflect.Value, path []string, fn func([]string, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := yamlKey(t.Field(i))
+		if key == "" {
+			continue
+		}
+		f := v.Field(i)
+		p := append(append([]string{}, path...), key)
+		if f.Kind() == reflect.Struct {
+			walk(f, p, fn)
+			continue
+		}
+		if settable(f.Type()) {
+			fn(p, f)
+		}
+	}
+}
+
+func lookup(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, key := range path {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if yamlKey(v.Type().Field(i)) == key {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+	return v, settable(v.Type())
+}
+
+func yamlKey(f reflect.StructField) string {
+	tag, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if tag == "-" {
+		return ""
+	}
+	return tag
+}
+
+func settable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64, reflect.Map, reflect.Slice:
+		return true
+	}
+	return false
+}
+
+func assign(f reflect.Value, value string) error {
+	if f.Kind() == reflect.Pointer {
+		if value == "" {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		p := reflect.New(f.Type().Elem())
+		if err := assign(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Map, reflect.Slice:
+		v := reflect.New(f.Type())
+		if err := yaml.Unmarshal([]byte(value), v.Interface()); err != nil {
+			return err
+		}
+		f.Set(v.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
 	return nil
 }
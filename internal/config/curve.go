@@ -0,0 +1,190 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Curve replays a recorded load shape, e.g. a diurnal curve exported from
+// Prometheus, instead of a flat load or stages.
+type Curve struct {
+	// File holds (offset, requests-per-second) points per series, as CSV
+	// (an offset column, then one column per series) or JSON ({"reads":
+	// [{"offset": 0, "rps": 120}, ...], "writes": [...]}). Offsets are
+	// seconds, or Go durations in CSV, relative to the first point. See
+	// CurveSeries for the series names.
+	File string `yaml:"file"`
+	// Compression squeezes time: 24 replays 24h of curve in 1h.
+	Compression float64 `yaml:"compression"`
+	// Scale multiplies every rate, e.g. 0.1 to replay 10% of production.
+	Scale float64 `yaml:"scale"`
+}
+
+// CurvePoint is the target rate of an operation at an offset of the run.
+type CurvePoint struct {
+	Offset time.Duration
+	RPS    float64
+}
+
+// CurveSeries reports whether name is a series a curve file may contain:
+// reads or writes, which pace the reads and writes of every service, or an
+// operation of a service's mix, e.g. expand, qualified by its service when
+// several services have an operation of that name, e.g. keto.check.
+func CurveSeries(name string) bool {
+	if name == "reads" || name == "writes" {
+		return true
+	}
+	if service, op, ok := strings.Cut(name, "."); ok {
+		return contains(Operations[service], op)
+	}
+	for _, ops := range Operations {
+		if contains(ops, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurveOperation returns the operation of service that the curve series
+// name paces, if any: name is the operation, or the operation qualified by
+// service.
+func CurveOperation(service, name string) (string, bool) {
+	if s, op, ok := strings.Cut(name, "."); ok {
+		return op, s == service && contains(Operations[service], op)
+	}
+	return name, contains(Operations[service], name)
+}
+
+// curveSeriesHint lists the series names in errors.
+const curveSeriesHint = "reads, writes or an operation such as expand or keto.check"
+
+// Load reads the curve file and returns its points per operation, sorted,
+// starting at offset zero, with compression and scale applied.
+func (c Curve) Load() (map[string][]CurvePoint, error) {
+	f, err := os.Open(c.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open curve file: %w", err)
+	}
+	defer f.Close()
+
+	var series map[string][]CurvePoint
+	if strings.EqualFold(filepath.Ext(c.File), ".json") {
+		series, err = parseCurveJSON(f)
+	} else {
+		series, err = parseCurveCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse curve file %s: %w", c.File, err)
+	}
+
+	compression, scale := c.Compression, c.Scale
+	if compression <= 0 {
+		compression = 1
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+
+	var first time.Duration
+	found := false
+	for _, points := range series {
+		sort.Slice(points, func(i, j int) bool { return points[i].Offset < points[j].Offset })
+		if len(points) > 0 && (!found || points[0].Offset < first) {
+			first, found = points[0].Offset, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("curve file %s has no points", c.File)
+	}
+	for _, points := range series {
+		for i := range points {
+			points[i].Offset = time.Duration(float64(points[i].Offset-first) / compression)
+			points[i].RPS *= scale
+		}
+	}
+	return series, nil
+}
+
+func parseCurveCSV(r io.Reader) (map[string][]CurvePoint, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("expected a header and at least one row")
+	}
+
+	header := rows[0]
+	if strings.TrimSpace(header[0]) != "offset" {
+		return nil, fmt.Errorf("first column must be \"offset\", got %q", header[0])
+	}
+	series := map[string][]CurvePoint{}
+	for col := 1; col < len(header); col++ {
+		if !CurveSeries(strings.TrimSpace(header[col])) {
+			return nil, fmt.Errorf("unknown column %q (expected %s)", header[col], curveSeriesHint)
+		}
+	}
+
+	for i, row := range rows[1:] {
+		offset, err := parseOffset(strings.TrimSpace(row[0]))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+2, err)
+		}
+		for col := 1; col < len(row) && col < len(header); col++ {
+			cell := strings.TrimSpace(row[col])
+			if cell == "" {
+				continue
+			}
+			rps, err := strconv.ParseFloat(cell, 64)
+			if err != nil || rps < 0 {
+				return nil, fmt.Errorf("row %d: invalid rate %q", i+2, cell)
+			}
+			op := strings.TrimSpace(header[col])
+			series[op] = append(series[op], CurvePoint{Offset: offset, RPS: rps})
+		}
+	}
+	return series, nil
+}
+
+func parseCurveJSON(r io.Reader) (map[string][]CurvePoint, error) {
+	var raw map[string][]struct {
+		Offset float64 `json:"offset"`
+		RPS    float64 `json:"rps"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	series := map[string][]CurvePoint{}
+	for op, points := range raw {
+		if !CurveSeries(op) {
+			return nil, fmt.Errorf("unknown operation %q (expected %s)", op, curveSeriesHint)
+		}
+		for _, p := range points {
+			if p.RPS < 0 {
+				return nil, fmt.Errorf("%s: negative rate at offset %g", op, p.Offset)
+			}
+			series[op] = append(series[op], CurvePoint{Offset: time.Duration(p.Offset * float64(time.Second)), RPS: p.RPS})
+		}
+	}
+	return series, nil
+}
+
+func parseOffset(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Threshold is a service level objective checked at the end of a run, e.g.
+// {service: keto, operation: check, metric: p99, below: 20}. Latencies are
+// response times in milliseconds, error_rate is a percentage and
+// throughput is in operations per second.
+type Threshold struct {
+	Service   string   `yaml:"service"`
+	Operation string   `yaml:"operation"`
+	Metric    string   `yaml:"metric"`
+	Below     *float64 `yaml:"below"`
+	Above     *float64 `yaml:"above"`
+}
+
+// ThresholdMetrics lists the metrics a threshold can apply to.
+var ThresholdMetrics = []string{"throughput", "error_rate", "mean", "p50", "p90", "p95", "p99", "p99.9", "max"}
+
+// String describes the objective, e.g. "keto check p99 < 20".
+func (t Threshold) String() string {
+	var bounds []string
+	if t.Above != nil {
+		bounds = append(bounds, fmt.Sprintf("> %g", *t.Above))
+	}
+	if t.Below != nil {
+		bounds = append(bounds, fmt.Sprintf("< %g", *t.Below))
+	}
+	return fmt.Sprintf("%s %s %s %s", t.Service, t.Operation, t.Metric, strings.Join(bounds, " and "))
+}
+
+// validateThresholds checks the thresholds name known services, operations
+// and metrics. Thresholds of services outside -scope are valid: they are
+// skipped at the end of the run, so one config can serve every scope.
+func validateThresholds(add func(key, format string, args ...any)) {
+	for i, t := range AppConfig.Thresholds {
+		key := fmt.Sprintf("thresholds[%d]", i)
+		ops, ok := Operations[t.Service]
+		if !ok {
+			add(key+".service", "must be one of hydra, kratos, keto, got %q", t.Service)
+		} else if !contains(ops, t.Operation) {
+			add(key+".operation", "unknown %s operation %q (expected one of %s)", t.Service, t.Operation, strings.Join(ops, ", "))
+		}
+		if !contains(ThresholdMetrics, t.Metric) {
+			add(key+".metric", "must be one of %s, got %q", strings.Join(ThresholdMetrics, ", "), t.Metric)
+		}
+		if t.Below == nil && t.Above == nil {
+			add(key, "must set below or above")
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a single validation finding. Line is the position of the
+// offending key in the YAML file, or 0 when the value did not come from it.
+type Problem struct {
+	Key     string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Key, p.Message)
+}
+
+// ValidationError carries every problem found in one validation pass.
+type ValidationError []Problem
+
+func (v ValidationError) Error() string {
+	lines := make([]string, len(v))
+	for i, p := range v {
+		lines[i] = "  - " + p.String()
+	}
+	return fmt.Sprintf("%d config problem(s):\n%s", len(v), strings.Join(lines, "\n"))
+}
+
+// Scopes lists the valid values of -scope.
+var Scopes = []string{"hydra", "kratos", "keto", "all"}
+
+var (
+	// positions maps dotted key paths of the last loaded file to their line.
+	positions map[string]int
+	// unknownKeys holds keys of the last loaded file that match no setting.
+	unknownKeys []Problem
+)
+
+// Validate checks AppConfig for the given scope and returns a
+// ValidationError listing every problem found, or nil.
+func Validate(scope string) error {
+	problems := append([]Problem{}, unknownKeys...)
+	add := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Line: positions[key], Message: fmt.Sprintf(format, args...)})
+	}
+
+	scope = strings.ToLower(scope)
+	if !contains(Scopes, scope) {
+		add("scope", "must be one of %s, got %q", strings.Join(Scopes, ", "), scope)
+	}
+
+	endpoints := []struct {
+		key     string
+		value   *string
+		service string
+	}{
+		{"hydra.admin_api", AppConfig.Hydra.AdminAPI, "hydra"},
+		{"hydra.public_api", AppConfig.Hydra.PublicAPI, "hydra"},
+		{"kratos.admin_api", AppConfig.Kratos.AdminAPI, "kratos"},
+		{"kratos.public_api", AppConfig.Kratos.PublicAPI, "kratos"},
+		{"keto.write_api", AppConfig.Keto.WriteAPI, "keto"},
+		{"keto.read_api", AppConfig.Keto.ReadAPI, "keto"},
+	}
+	for _, e := range endpoints {
+		if e.value == nil {
+			if scope == e.service || scope == "all" {
+				add(e.key, "is required for scope %s", scope)
+			}
+			continue
+		}
+		if err := checkURL(*e.value); err != nil {
+			add(e.key, "%v", err)
+		}
+	}
+
+	mixes := map[string]map[string]float64{
+		"hydra":  AppConfig.Hydra.Operations,
+		"kratos": AppConfig.Kratos.Operations,
+		"keto":   AppConfig.Keto.Operations,
+	}
+	for _, service := range []string{"hydra", "kratos", "keto"} {
+		mix := mixes[service]
+		if len(mix) == 0 {
+			continue
+		}
+		total := 0.0
+		for name, weight := range mix {
+			key := service + ".operations." + name
+			if !contains(Operations[service], name) {
+				add(key, "unknown %s operation (expected one of %s)", service, strings.Join(Operations[service], ", "))
+			}
+			if weight < 0 {
+				add(key, "weight must not be negative, got %g", weight)
+			}
+			total += weight
+		}
+		if total <= 0 {
+			add(service+".operations", "weights must add up to more than 0")
+		}
+	}
+
+	if AppConfig.Workload.Concurrency < 0 {
+		add("workload.concurrency", "must not be negative, got %d", AppConfig.Workload.Concurrency)
+	}
+	if AppConfig.Workload.IntervalSec < 0 {
+		add("workload.interval_sec", "must not be negative, got %d", AppConfig.Workload.IntervalSec)
+	}
+	if AppConfig.Workload.Writers < 0 {
+		add("workload.writers", "must not be negative, got %d", AppConfig.Workload.Writers)
+	}
+	if AppConfig.Workload.QueueDepth < 0 {
+		add("workload.queue_depth", "must not be negative, got %d", AppConfig.Workload.QueueDepth)
+	}
+	if AppConfig.Workload.ReadRatio < 0 {
+		add("workload.read_ratio", "must not be negative, got %d", AppConfig.Workload.ReadRatio)
+	}
+	if AppConfig.Workload.DurationSec < 0 {
+		add("workload.duration_sec", "must not be negative, got %d", AppConfig.Workload.DurationSec)
+	}
+	if AppConfig.Workload.ChecksPerSecond < 0 {
+		add("workload.checks_per_second", "must not be negative, got %g", AppConfig.Workload.ChecksPerSecond)
+	}
+	if AppConfig.Workload.WritesPerSecond < 0 {
+		add("workload.writes_per_second", "must not be negative, got %g", AppConfig.Workload.WritesPerSecond)
+	}
+
+	for i, st := range AppConfig.Workload.Stages {
+		key := fmt.Sprintf("workload.stages[%d]", i)
+		if st.DurationSec <= 0 {
+			add(key+".duration_sec", "must be positive, got %d", st.DurationSec)
+		}
+		if st.ChecksPerSecond != nil && *st.ChecksPerSecond < 0 {
+			add(key+".checks_per_second", "must not be negative, got %g", *st.ChecksPerSecond)
+		}
+		if st.WritesPerSecond != nil && *st.WritesPerSecond < 0 {
+			add(key+".writes_per_second", "must not be negative, got %g", *st.WritesPerSecond)
+		}
+		if st.Concurrency != nil && *st.Concurrency < 0 {
+			add(key+".concurrency", "must not be negative, got %d", *st.Concurrency)
+		}
+		if st.ChecksPerSecond == nil && st.WritesPerSecond == nil && st.Concurrency == nil && i == 0 {
+			add(key, "first stage must set checks_per_second, writes_per_second or concurrency")
+		}
+	}
+
+	if c := AppConfig.Workload.Curve; c.File != "" {
+		if len(AppConfig.Workload.Stages) > 0 {
+			add("workload.curve", "cannot be combined with workload.stages")
+		}
+		if c.Compression < 0 {
+			add("workload.curve.compression", "must not be negative, got %g", c.Compression)
+		}
+		if c.Scale < 0 {
+			add("workload.curve.scale", "must not be negative, got %g", c.Scale)
+		}
+		if _, err := c.Load(); err != nil {
+			add("workload.curve.file", "%v", err)
+		}
+	}
+
+	if cb := AppConfig.Workload.CircuitBreaker; cb.ErrorRate != 0 || cb.Action != "" {
+		if cb.ErrorRate < 0 || cb.ErrorRate > 100 {
+			add("workload.circuit_breaker.error_rate", "must be a percentage between 0 and 100, got %g", cb.ErrorRate)
+		}
+		if cb.WindowSec < 0 {
+			add("workload.circuit_breaker.window_sec", "must not be negative, got %d", cb.WindowSec)
+		}
+		if cb.MinRequests < 0 {
+			add("workload.circuit_breaker.min_requests", "must not be negative, got %d", cb.MinRequests)
+		}
+		if cb.ProbeIntervalSec < 0 {
+			add("workload.circuit_breaker.probe_interval_sec", "must not be negative, got %d", cb.ProbeIntervalSec)
+		}
+		if cb.Action != "" && cb.Action != "abort" && cb.Action != "pause" {
+			add("workload.circuit_breaker.action", "must be abort or pause, got %q", cb.Action)
+		}
+	}
+
+	if m := AppConfig.Metrics; m.Address != "" {
+		if _, _, err := net.SplitHostPort(m.Address); err != nil {
+			add("metrics.address", "must be host:port, e.g. 0.0.0.0:2112: %v", err)
+		}
+	}
+	if m := AppConfig.Metrics; m.Path != "" && !strings.HasPrefix(m.Path, "/") {
+		add("metrics.path", "must start with /, got %q", m.Path)
+	}
+
+	push := AppConfig.Metrics.Push
+	if push.Pushgateway != "" {
+		if err := checkURL(push.Pushgateway); err != nil {
+			add("metrics.push.pushgateway", "%v", err)
+		}
+	}
+	if push.RemoteWrite != "" {
+		if err := checkURL(push.RemoteWrite); err != nil {
+			add("metrics.push.remote_write", "%v", err)
+		}
+	}
+	if push.IntervalSec < 0 {
+		add("metrics.push.interval_sec", "must not be negative, got %d", push.IntervalSec)
+	}
+
+	validateHTTP(add)
+	validateLabels(add)
+	validateThresholds(add)
+
+	if len(problems) > 0 {
+		return ValidationError(problems)
+	}
+	return nil
+}
+
+func validateHTTP(add func(key, format string, args ...any)) {
+	h := AppConfig.HTTP
+	for _, f := range []struct {
+		key   string
+		value int
+	}{
+		{"http.max_idle_conns", h.MaxIdleConns},
+		{"http.max_idle_conns_per_host", h.MaxIdleConnsPerHost},
+		{"http.max_conns_per_host", h.MaxConnsPerHost},
+		{"http.idle_conn_timeout_sec", h.IdleConnTimeoutSec},
+		{"http.dial_timeout_ms", h.DialTimeoutMs},
+		{"http.timeout_ms", h.TimeoutMs},
+	} {
+		if f.value < 0 {
+			add(f.key, "must not be negative, got %d", f.value)
+		}
+	}
+	if h.KeepAliveSec < -1 {
+		add("http.keep_alive_sec", "must be -1 (disabled), 0 (default) or positive, got %d", h.KeepAliveSec)
+	}
+	walk(reflect.ValueOf(h.Timeouts), []string{"http", "timeouts_ms"}, func(path []string, v reflect.Value) {
+		if v.Int() < 0 {
+			add(strings.Join(path, "."), "must not be negative, got %d", v.Int())
+		}
+	})
+}
+
+// labelName matches valid Prometheus label names.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ReservedLabels are the label names the metrics already use.
+var ReservedLabels = []string{"run_id", "job", "instance", "service", "operation", "endpoint", "status_class", "result", "le", "quantile"}
+
+func validateLabels(add func(key, format string, args ...any)) {
+	names := make([]string, 0, len(AppConfig.Labels))
+	for name := range AppConfig.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case !labelName.MatchString(name) || strings.HasPrefix(name, "__"):
+			add("labels."+name, "must be a Prometheus label name: letters, digits and underscores, not starting with a digit or __")
+		case contains(ReservedLabels, name):
+			add("labels."+name, "is reserved (reserved names: %s)", strings.Join(ReservedLabels, ", "))
+		}
+	}
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid URL %q: missing host", raw)
+	}
+	return nil
+}
+
+// index records the line of every key in doc and collects keys that do not
+// map onto a field of Config, so that unknown settings are reported
+// together with the other problems rather than silently ignored.
+func index(doc *yaml.Node) {
+	positions = map[string]int{}
+	unknownKeys = nil
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		indexNode(doc.Content[0], reflect.TypeOf(Config{}), "")
+	}
+}
+
+func indexNode(n *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			key := k.Value
+			if path != "" {
+				key = path + "." + k.Value
+			}
+			positions[key] = k.Line
+
+			f, ok := fieldByKey(t, k.Value)
+			if !ok {
+				unknownKeys = append(unknownKeys, Problem{Key: key, Line: k.Line, Message: fmt.Sprintf("unknown key (expected one of %s)", strings.Join(fieldKeys(t), ", "))})
+				continue
+			}
+			indexNode(v, f.Type, key)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := path + "." + n.Content[i].Value
+			positions[key] = n.Content[i].Line
+			indexNode(n.Content[i+1], t.Elem(), key)
+		}
+	case n.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for i, c := range n.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			positions[key] = c.Line
+			indexNode(c, t.Elem(), key)
+		}
+	}
+}
+
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlKey(t.Field(i)) == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldKeys lists the YAML keys of the fields of struct type t.
+func fieldKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		if key := yamlKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	doc := `keto:
+  write_api: http://localhost:4467
+  read_api: localhost:4466
+  operations: {check: 70, chek: 30}
+workload:
+  concurency: 10
+  writers: -1
+labels:
+  env: ci
+  run_id: nightly
+  2fast: "yes"
+`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var problems ValidationError
+	if err := Validate("keto"); !errors.As(err, &problems) {
+		t.Fatalf("Validate() = %v, want a ValidationError", err)
+	}
+	// Unknown keys come first, then the other problems, each at the line
+	// of its key.
+	want := []struct {
+		key     string
+		line    int
+		message string
+	}{
+		{"workload.concurency", 6, "unknown key (expected one of read_ratio, concurrency, writers,"},
+		{"keto.read_api", 3, `invalid URL "localhost:4466": scheme must be http or https`},
+		{"keto.operations.chek", 4, "unknown keto operation (expected one of write, check, expand, delete)"},
+		{"workload.writers", 7, "must not be negative, got -1"},
+		{"labels.2fast", 11, "must be a Prometheus label name"},
+		{"labels.run_id", 10, "is reserved"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("Validate() found %d problems, want %d:\n%v", len(problems), len(want), problems)
+	}
+	for i, w := range want {
+		p := problems[i]
+		if p.Key != w.key || p.Line != w.line || !strings.HasPrefix(p.Message, w.message) {
+			t.Errorf("problem %d = %v, want line %d: %s: %s...", i, p, w.line, w.key, w.message)
+		}
+	}
+
+	// A value set by an override has no line in the file.
+	if err := Set("workload.queue_depth", "-5"); err != nil {
+		t.Fatal(err)
+	}
+	errors.As(Validate("keto"), &problems)
+	found := false
+	for _, p := range problems {
+		if p.Key == "workload.queue_depth" {
+			found = true
+			if p.Line != 0 {
+				t.Errorf("problem of an override = %v, want no line", p)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Validate() = %v, want a workload.queue_depth problem", problems)
+	}
+}
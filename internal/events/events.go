@@ -0,0 +1,186 @@
+// Package events records one JSON line per HTTP request sent to Ory, for
+// post-run analysis of individual outliers that the histograms aggregate
+// away.
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bufferSize bounds the events waiting to be written. Once full, new events
+// are dropped rather than slowing down the workers.
+const bufferSize = 65536
+
+// Event is one HTTP request sent to Ory, retries included.
+type Event struct {
+	Time      time.Time `json:"ts"`
+	RunID     string    `json:"run_id"`
+	Service   string    `json:"service"`
+	Operation string    `json:"operation"`
+	Method    string    `json:"method"`
+	Endpoint  string    `json:"endpoint"`
+	Worker    string    `json:"worker,omitempty"`
+	Attempt   int       `json:"attempt"`
+	// Status is the HTTP status code, 0 when no response came back.
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	// Error classifies failed requests: "4xx", "5xx", "timeout",
+	// "connection", "canceled" or "error".
+	Error    string   `json:"error,omitempty"`
+	Entities []string `json:"entities,omitempty"`
+}
+
+// Writer appends events to a file as NDJSON from a background goroutine.
+type Writer struct {
+	path   string
+	runID  string
+	sample float64
+	f      *os.File
+	events chan Event
+	// mu guards events against being closed while Record sends to it.
+	mu     sync.RWMutex
+	closed bool
+
+	written atomic.Int64
+	dropped atomic.Int64
+	done    sync.WaitGroup
+}
+
+var current atomic.Pointer[Writer]
+
+// Start creates the file at path and records the events of run runID into
+// it until Close, keeping a random sample fraction of them (1 keeps all).
+func Start(path, runID string, sample float64) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{path: path, runID: runID, sample: sample, f: f, events: make(chan Event, bufferSize)}
+	w.done.Add(1)
+	go w.loop()
+	current.Store(w)
+	return w, nil
+}
+
+// loop writes the events as they come, flushing at least every second so
+// that the file can be tailed during the run.
+func (w *Writer) loop() {
+	defer w.done.Done()
+	buf := bufio.NewWriterSize(w.f, 1<<20)
+	enc := json.NewEncoder(buf)
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case e, ok := <-w.events:
+			if !ok {
+				if err := buf.Flush(); err != nil {
+					slog.Warn("⚠️  Failed to write events", "path", w.path, "error", err)
+				}
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				slog.Warn("⚠️  Failed to write event", "path", w.path, "error", err)
+				continue
+			}
+			w.written.Add(1)
+		case <-t.C:
+			if err := buf.Flush(); err != nil {
+				slog.Warn("⚠️  Failed to write events", "path", w.path, "error", err)
+			}
+		}
+	}
+}
+
+// Close stops recording, writes the events still buffered and closes the
+// file.
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	current.CompareAndSwap(w, nil)
+	w.mu.Lock()
+	w.closed = true
+	close(w.events)
+	w.mu.Unlock()
+	w.done.Wait()
+	if n := w.dropped.Load(); n > 0 {
+		log.Printf("📝 Wrote %d events to %s (%d dropped: the writer fell behind)", w.written.Load(), w.path, n)
+	} else {
+		log.Printf("📝 Wrote %d events to %s", w.written.Load(), w.path)
+	}
+	return w.f.Close()
+}
+
+// Enabled reports whether events are being recorded, so that callers can
+// skip building them otherwise.
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Record queues e to be written, unless it is sampled out or the buffer is
+// full. It never blocks.
+func Record(e Event) {
+	w := current.Load()
+	if w == nil || (w.sample < 1 && rand.Float64() >= w.sample) {
+		return
+	}
+	e.RunID = w.runID
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.events <- e:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+type contextKey int
+
+const (
+	workerKey contextKey = iota
+	attemptKey
+	entitiesKey
+)
+
+// WithWorker returns a context attributing the requests sent with it to
+// worker.
+func WithWorker(ctx context.Context, worker string) context.Context {
+	return context.WithValue(ctx, workerKey, worker)
+}
+
+// WithAttempt returns a context numbering the requests sent with it as
+// attempt n of a call being retried.
+func WithAttempt(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, attemptKey, n)
+}
+
+// WithEntities returns a context attributing the requests sent with it to
+// the Ory entities ids, e.g. a tuple's object and subject.
+func WithEntities(ctx context.Context, ids ...string) context.Context {
+	return context.WithValue(ctx, entitiesKey, ids)
+}
+
+// From returns the worker, attempt (1 when unset) and entities that ctx
+// attributes requests to.
+func From(ctx context.Context) (worker string, attempt int, entities []string) {
+	worker, _ = ctx.Value(workerKey).(string)
+	entities, _ = ctx.Value(entitiesKey).([]string)
+	attempt, ok := ctx.Value(attemptKey).(int)
+	if !ok {
+		attempt = 1
+	}
+	return worker, attempt, entities
+}
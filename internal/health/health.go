@@ -0,0 +1,23 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+
+	"crdb-ory-load-test/internal/httpclient"
+)
+
+// Alive calls the /health/alive endpoint of the Ory API at baseURL. It
+// returns the HTTP status, 0 when no response came back, and an error
+// unless the API answered 200.
+func Alive(baseURL string) (int, error) {
+	resp, err := httpclient.Client("health", "alive").Get(baseURL + "/health/alive")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,128 @@
+// Package httpclient builds the HTTP clients of the Ory API calls. They
+// share one connection pool, tuned by the http section of the config, so
+// that hundreds of workers reuse their connections and the measured
+// latency reflects Ory and CockroachDB rather than TCP setup in the load
+// tool.
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/metrics"
+)
+
+// Defaults for the http settings left unset.
+const (
+	// RetryDelay is the pause between two attempts of an Ory API call.
+	RetryDelay = 100 * time.Millisecond
+
+	DefaultMaxIdleConnsPerHost = 1024
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultDialTimeout         = 5 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+)
+
+// defaultTimeouts bound the requests of each call unless configured.
+var defaultTimeouts = map[string]time.Duration{
+	"hydra.create_client":      60 * time.Second,
+	"hydra.grant":              60 * time.Second,
+	"hydra.introspect":         60 * time.Second,
+	"kratos.registration_flow": 5 * time.Second,
+	"kratos.registration":      5 * time.Second,
+	"kratos.identity_lookup":   60 * time.Second,
+	"keto.check":               5 * time.Second,
+	"keto.write":               5 * time.Second,
+	"keto.expand":              5 * time.Second,
+	"keto.delete":              5 * time.Second,
+	"health.alive":             3 * time.Second,
+}
+
+var (
+	transportOnce sync.Once
+	transport     *http.Transport
+	clients       sync.Map // "service.call" -> *http.Client
+)
+
+// Client returns the client of one Ory API call, e.g. Client("keto",
+// "check"): its requests are instrumented as metrics.Transport does, share
+// the pooled connections of every other call and time out as configured.
+func Client(service, call string) *http.Client {
+	key := service + "." + call
+	if c, ok := clients.Load(key); ok {
+		return c.(*http.Client)
+	}
+	transportOnce.Do(func() { transport = NewTransport(config.AppConfig.HTTP) })
+	c, _ := clients.LoadOrStore(key, &http.Client{
+		Timeout:   Timeout(config.AppConfig.HTTP, service, call),
+		Transport: metrics.Transport(service, call, transport),
+	})
+	return c.(*http.Client)
+}
+
+// Timeout returns the request timeout of a call: its own setting, else
+// http.timeout_ms, else its default.
+func Timeout(cfg config.HTTP, service, call string) time.Duration {
+	if ms := cfg.Timeouts.Of(service, call); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	if cfg.TimeoutMs > 0 {
+		return time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	return defaultTimeouts[service+"."+call]
+}
+
+// Backoff waits RetryDelay before the next attempt of a call, after
+// draining and closing the body of resp, the rejected response of the last
+// attempt if any, so that its connection returns to the pool. It returns
+// the error of ctx if ctx is done first.
+func Backoff(ctx context.Context, resp *http.Response) error {
+	if resp != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	t := time.NewTimer(RetryDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewTransport returns a transport pooling connections as configured by
+// cfg. Unlike http.DefaultTransport, which keeps 2 idle connections per
+// host, it keeps enough for every worker by default.
+func NewTransport(cfg config.HTTP) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   or(time.Duration(cfg.DialTimeoutMs)*time.Millisecond, DefaultDialTimeout),
+		KeepAlive: or(time.Duration(cfg.KeepAliveSec)*time.Second, DefaultKeepAlive),
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   or(cfg.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost),
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       or(time.Duration(cfg.IdleConnTimeoutSec)*time.Second, DefaultIdleConnTimeout),
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// or returns v, or def when v is 0.
+func or[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+	return v
+}
@@ -2,14 +2,21 @@ package keto
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
-	"errors"
+	"net/url"
+	"strconv"
 
 	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
+	"crdb-ory-load-test/internal/httpclient"
+	"crdb-ory-load-test/internal/logging"
+	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/stats"
 )
 
 type CheckRequest struct {
@@ -23,6 +30,12 @@ type CheckResponse struct {
 	Allowed bool `json:"allowed"`
 }
 
+// ExpandTree is the root of a Keto subject tree; its children are not
+// needed by the load test.
+type ExpandTree struct {
+	Type string `json:"type"`
+}
+
 type RelationTuple struct {
 	Namespace string `json:"namespace"`
 	Object    string `json:"object"`
@@ -30,7 +43,9 @@ type RelationTuple struct {
 	SubjectID string `json:"subject_id"`
 }
 
-func CheckPermission(namespace, object, relation, subjectID string) (bool, error) {
+func CheckPermission(ctx context.Context, namespace, object, relation, subjectID string) (bool, error) {
+	defer stats.Calls.Time("keto", "check")()
+
 	reqBody := CheckRequest{
 		Namespace: namespace,
 		Object:    object,
@@ -40,47 +55,57 @@ func CheckPermission(namespace, object, relation, subjectID string) (bool, error
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		fmt.Printf("❌ Error marshaling check request: %v\n", err)
+		logging.From(ctx).Error("❌ Error marshaling check request", "op", "check", "error", err)
 		return false, err
 	}
 
 	url := *config.AppConfig.Keto.ReadAPI + "/relation-tuples/check"
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := httpclient.Client("keto", "check")
 
 	var resp *http.Response
 	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err = client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		req, e := http.NewRequestWithContext(events.WithAttempt(ctx, attempt), http.MethodPost, url, bytes.NewBuffer(jsonData))
+		if e != nil {
+			return false, fmt.Errorf("failed to build request: %w", e)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err = client.Do(req)
 		if err == nil && resp != nil && resp.StatusCode == 200 {
 			break
 		}
 		if attempt < 3 {
-			fmt.Printf("🔁 Retry %d: Keto check failed (status=%v, error=%v)\n", attempt, getStatus(resp), err)
-			time.Sleep(100 * time.Millisecond)
+			logging.From(ctx).Warn("🔁 Keto check failed, retrying", "op", "check", "attempt", attempt, "status", getStatus(resp), "error", err)
+			metrics.From(ctx).RetryCounter.WithLabelValues("keto", "check").Inc()
+			if e := httpclient.Backoff(ctx, resp); e != nil {
+				return false, e
+			}
 		}
 	}
 
 	if err != nil || resp == nil {
-		fmt.Printf("❌ Final failure: Keto check failed after 3 attempts. Error: %v\n", err)
+		logging.From(ctx).Error("❌ Final failure: Keto check failed after 3 attempts", "op", "check", "error", err)
 		return false, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("⚠️  Unexpected status from Keto: %d\nResponse body: %s\n", resp.StatusCode, string(body))
+		logging.From(ctx).Error("⚠️  Unexpected status from Keto", "op", "check", "status", resp.StatusCode, "body", string(body))
 		return false, errors.New("⚠️  Unexpected status from Keto")
 	}
 
 	var checkResp CheckResponse
 	if err := json.NewDecoder(resp.Body).Decode(&checkResp); err != nil {
-		fmt.Printf("❌ Error decoding Keto check response: %v\n", err)
+		logging.From(ctx).Error("❌ Error decoding Keto check response", "op", "check", "error", err)
 		return false, err
 	}
 
 	return checkResp.Allowed, nil
 }
 
-func WriteTuple(namespace, object, relation, subjectID string) error {
+func WriteTuple(ctx context.Context, namespace, object, relation, subjectID string) error {
+	defer stats.Calls.Time("keto", "write")()
+
 	tuple := RelationTuple{
 		Namespace: namespace,
 		Object:    object,
@@ -94,13 +119,13 @@ func WriteTuple(namespace, object, relation, subjectID string) error {
 	}
 
 	url := *config.AppConfig.Keto.WriteAPI + "/admin/relation-tuples"
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to build request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := httpclient.Client("keto", "write")
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("HTTP request failed: %w", err)
@@ -112,7 +137,91 @@ func WriteTuple(namespace, object, relation, subjectID string) error {
 		return fmt.Errorf("PUT failed: status=%v body=%s", resp.StatusCode, string(body))
 	}
 
-    fmt.Printf("🔑  Permission %s granted to %s for object %s\n", tuple.Relation, tuple.SubjectID, tuple.Object)
+	logging.From(ctx).Debug("🔑  Permission granted", "op", "write", "relation", tuple.Relation, "subject", tuple.SubjectID, "object", tuple.Object)
+	return nil
+}
+
+func ExpandPermission(ctx context.Context, namespace, object, relation string, maxDepth int) (bool, error) {
+	defer stats.Calls.Time("keto", "expand")()
+
+	query := url.Values{}
+	query.Set("namespace", namespace)
+	query.Set("object", object)
+	query.Set("relation", relation)
+	query.Set("max-depth", strconv.Itoa(maxDepth))
+
+	endpoint := *config.AppConfig.Keto.ReadAPI + "/relation-tuples/expand?" + query.Encode()
+	client := httpclient.Client("keto", "expand")
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		req, e := http.NewRequestWithContext(events.WithAttempt(ctx, attempt), http.MethodGet, endpoint, nil)
+		if e != nil {
+			return false, fmt.Errorf("failed to build request: %w", e)
+		}
+		resp, err = client.Do(req)
+		if err == nil && resp != nil && resp.StatusCode == 200 {
+			break
+		}
+		if attempt < 3 {
+			logging.From(ctx).Warn("🔁 Keto expand failed, retrying", "op", "expand", "attempt", attempt, "status", getStatus(resp), "error", err)
+			metrics.From(ctx).RetryCounter.WithLabelValues("keto", "expand").Inc()
+			if e := httpclient.Backoff(ctx, resp); e != nil {
+				return false, e
+			}
+		}
+	}
+
+	if err != nil || resp == nil {
+		logging.From(ctx).Error("❌ Final failure: Keto expand failed after 3 attempts", "op", "expand", "error", err)
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		logging.From(ctx).Error("⚠️  Unexpected status from Keto", "op", "expand", "status", resp.StatusCode, "body", string(body))
+		return false, errors.New("⚠️  Unexpected status from Keto")
+	}
+
+	var tree ExpandTree
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		logging.From(ctx).Error("❌ Error decoding Keto expand response", "op", "expand", "error", err)
+		return false, err
+	}
+
+	return tree.Type != "", nil
+}
+
+func DeleteTuple(ctx context.Context, namespace, object, relation, subjectID string) error {
+	defer stats.Calls.Time("keto", "delete")()
+
+	query := url.Values{}
+	query.Set("namespace", namespace)
+	query.Set("object", object)
+	query.Set("relation", relation)
+	query.Set("subject_id", subjectID)
+
+	endpoint := *config.AppConfig.Keto.WriteAPI + "/admin/relation-tuples?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	client := httpclient.Client("keto", "delete")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("DELETE failed: status=%v body=%s", resp.StatusCode, string(body))
+	}
+
+	logging.From(ctx).Debug("🗑️  Permission revoked", "op", "delete", "relation", relation, "subject", subjectID, "object", object)
 	return nil
 }
 
@@ -2,227 +2,265 @@ package kratos
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
 	"crdb-ory-load-test/internal/config"
+	"crdb-ory-load-test/internal/events"
+	"crdb-ory-load-test/internal/httpclient"
+	"crdb-ory-load-test/internal/logging"
+	"crdb-ory-load-test/internal/metrics"
+	"crdb-ory-load-test/internal/stats"
 )
 
 type RegistrationRequest struct {
-	Method string `json:"method"`
-	Password  string `json:"password"`
-	Traits struct {
-	    Email string `json:"email"`
-	    Name struct {
-	        First string `json:"first"`
-	        Last string `json:"last"`
-	    }`json:"name"`
-	}`json:"traits"`
+	Method   string `json:"method"`
+	Password string `json:"password"`
+	Traits   struct {
+		Email string `json:"email"`
+		Name  struct {
+			First string `json:"first"`
+			Last  string `json:"last"`
+		} `json:"name"`
+	} `json:"traits"`
 }
 
-var registrationFlowResponse map[string]interface{}
+type registrationFlowResponse struct {
+	ID string `json:"id"`
+}
 
 type RegistrationResponse struct {
-    Continue string `json:"continue_with"`
-    Identity struct {
-        Identifier string `json:"id"`
-        SchemaID string `json:"schema_id"`
-        SchemaURL string `json:"schema_url"`
-        State string `json:"state"`
-        StateChangedAt string `json:"state_changed_at"`
-        Traits struct {
-            Email string `json:"email"`
-            Name struct {
-                First string `json:"first"`
-                Last string `json:"last"`
-            }`json:"name"`
-        }`json:"traits"`
-        MetadataPublic string `json:"metadata_public"`
-        OrganizationID string `json:"organization_id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-    } `json:"identity"`
+	Continue string `json:"continue_with"`
+	Identity struct {
+		Identifier     string `json:"id"`
+		SchemaID       string `json:"schema_id"`
+		SchemaURL      string `json:"schema_url"`
+		State          string `json:"state"`
+		StateChangedAt string `json:"state_changed_at"`
+		Traits         struct {
+			Email string `json:"email"`
+			Name  struct {
+				First string `json:"first"`
+				Last  string `json:"last"`
+			} `json:"name"`
+		} `json:"traits"`
+		MetadataPublic string    `json:"metadata_public"`
+		OrganizationID string    `json:"organization_id"`
+		CreatedAt      time.Time `json:"created_at"`
+		UpdatedAt      time.Time `json:"updated_at"`
+	} `json:"identity"`
 }
 
 type CheckIdentityResponse struct {
-    Identifier string `json:"id"`
-    SchemaID string `json:"schema_id"`
-    SchemaURL string `json:"schema_url"`
-    State string `json:"state"`
-    StateChangedAt string `json:"state_changed_at"`
-    Traits struct {
-        Email string `json:"email"`
-        Name struct {
-            First string `json:"first"`
-            Last string `json:"last"`
-        }`json:"name"`
-    }`json:"traits"`
-    MetadataPublic string `json:"metadata_public"`
-    MetadataAdmin string `json:"metadata_admin"`
-    CreatedAt time.Time `json:"created_at"`
-    UpdatedAt time.Time `json:"updated_at"`
-    OrganizationID string `json:"organization_id"`
+	Identifier     string `json:"id"`
+	SchemaID       string `json:"schema_id"`
+	SchemaURL      string `json:"schema_url"`
+	State          string `json:"state"`
+	StateChangedAt string `json:"state_changed_at"`
+	Traits         struct {
+		Email string `json:"email"`
+		Name  struct {
+			First string `json:"first"`
+			Last  string `json:"last"`
+		} `json:"name"`
+	} `json:"traits"`
+	MetadataPublic string    `json:"metadata_public"`
+	MetadataAdmin  string    `json:"metadata_admin"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	OrganizationID string    `json:"organization_id"`
 }
 
-func createRegistrationFlow() (string, error) {
+func createRegistrationFlow(ctx context.Context) (string, error) {
+	defer stats.Calls.Time("kratos", "registration_flow")()
+
 	url := *config.AppConfig.Kratos.PublicAPI + "/self-service/registration/api"
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := httpclient.Client("kratos", "registration_flow")
 
 	var resp *http.Response
 	var err error
 	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err = client.Get(url)
+		req, e := http.NewRequestWithContext(events.WithAttempt(ctx, attempt), http.MethodGet, url, nil)
+		if e != nil {
+			return "", fmt.Errorf("failed to build request: %w", e)
+		}
+		resp, err = client.Do(req)
 		if err == nil && resp != nil && resp.StatusCode == 200 {
 			break
 		}
 		if attempt < 3 {
-			fmt.Printf("🔁 Retry %d: Kratos self-service registration flow failed (status=%v, error=%v)\n", attempt, getStatus(resp), err)
-			time.Sleep(100 * time.Millisecond)
+			logging.From(ctx).Warn("🔁 Kratos self-service registration flow failed, retrying", "op", "registration_flow", "attempt", attempt, "status", getStatus(resp), "error", err)
+			metrics.From(ctx).RetryCounter.WithLabelValues("kratos", "registration_flow").Inc()
+			if e := httpclient.Backoff(ctx, resp); e != nil {
+				return "", e
+			}
 		}
 	}
 
 	if err != nil || resp == nil {
-		fmt.Printf("❌   Final failure: Kratos self-service registration flow after 3 attempts. Error: %v\n", err)
+		logging.From(ctx).Error("❌ Final failure: Kratos self-service registration flow after 3 attempts", "op", "registration_flow", "error", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("⚠️  Unexpected status from Kratos: %d\nResponse body: %s\n", resp.StatusCode, string(body))
+		logging.From(ctx).Error("⚠️  Unexpected status from Kratos", "op", "registration_flow", "status", resp.StatusCode, "body", string(body))
 		return "", errors.New("⚠️  Unexpected status from Kratos")
 	}
 
-    body, _ := io.ReadAll(resp.Body)
-    e := json.Unmarshal([]byte(body), &registrationFlowResponse)
-    if e != nil {
-        fmt.Printf("❌ Error decoding Kratos registration flow response: %v\n", e)
-        return "", e
-    }
+	var flow registrationFlowResponse
+	if e := json.NewDecoder(resp.Body).Decode(&flow); e != nil {
+		logging.From(ctx).Error("❌ Error decoding Kratos registration flow response", "op", "registration_flow", "error", e)
+		return "", e
+	}
 
-	return registrationFlowResponse["id"].(string), nil
+	return flow.ID, nil
 }
 
-func registrationIdentity(flowID, email, firstName, lastName, password string) (bool, error) {
-    var reqBody RegistrationRequest
-    reqBody.Method = "password"
-    reqBody.Password = password
-    reqBody.Traits.Email = email
-    reqBody.Traits.Name.First = firstName
-    reqBody.Traits.Name.Last = lastName
+func registrationIdentity(ctx context.Context, flowID, email, firstName, lastName, password string) (bool, error) {
+	defer stats.Calls.Time("kratos", "registration")()
+
+	var reqBody RegistrationRequest
+	reqBody.Method = "password"
+	reqBody.Password = password
+	reqBody.Traits.Email = email
+	reqBody.Traits.Name.First = firstName
+	reqBody.Traits.Name.Last = lastName
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		fmt.Printf("❌ Error marshaling registration request: %v\n", err)
+		logging.From(ctx).Error("❌ Error marshaling registration request", "op", "registration", "error", err)
 		return false, err
 	}
 
 	url := *config.AppConfig.Kratos.PublicAPI + "/self-service/registration?flow=" + flowID
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := httpclient.Client("kratos", "registration")
 
 	var resp *http.Response
 	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err = client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		req, e := http.NewRequestWithContext(events.WithAttempt(ctx, attempt), http.MethodPost, url, bytes.NewBuffer(jsonData))
+		if e != nil {
+			return false, fmt.Errorf("failed to build request: %w", e)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err = client.Do(req)
 		if err == nil && resp != nil && resp.StatusCode == 200 {
 			break
 		}
 		if attempt < 3 {
-			fmt.Printf("🔁 Retry %d: Kratos self-service registration failed (status=%v, error=%v)\n", attempt, getStatus(resp), err)
-			time.Sleep(100 * time.Millisecond)
+			logging.From(ctx).Warn("🔁 Kratos self-service registration failed, retrying", "op", "registration", "attempt", attempt, "status", getStatus(resp), "error", err)
+			metrics.From(ctx).RetryCounter.WithLabelValues("kratos", "registration").Inc()
+			if e := httpclient.Backoff(ctx, resp); e != nil {
+				return false, e
+			}
 		}
 	}
 
 	if err != nil || resp == nil {
-		fmt.Printf("❌   Final failure: Kratos self-service registration after 3 attempts. Error: %v\n", err)
+		logging.From(ctx).Error("❌ Final failure: Kratos self-service registration after 3 attempts", "op", "registration", "error", err)
 		return false, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("⚠️  Unexpected status from Kratos: %d\nResponse body: %s\n", resp.StatusCode, string(body))
+		logging.From(ctx).Error("⚠️  Unexpected status from Kratos", "op", "registration", "status", resp.StatusCode, "body", string(body))
 		return false, errors.New("⚠️  Unexpected status from Kratos")
 	}
 
 	var registrationResponse RegistrationResponse
 	if e := json.NewDecoder(resp.Body).Decode(&registrationResponse); e != nil {
-		fmt.Printf("❌ Error decoding Kratos registration response: %v\n", e)
+		logging.From(ctx).Error("❌ Error decoding Kratos registration response", "op", "registration", "error", e)
 		return false, e
 	}
 
-    fmt.Printf("🪪  Identity %s registered with identifier: %s\n", email, registrationResponse.Identity.Identifier)
+	logging.From(ctx).Debug("🪪  Identity registered", "op", "registration", "email", email, "id", registrationResponse.Identity.Identifier)
 	return true, nil
 }
 
-func CheckIdentity(email string) (bool, error) {
-    url := *config.AppConfig.Kratos.AdminAPI + "/admin/identities?email=" + email
-	client := &http.Client{Timeout: 60 * time.Second}
+func CheckIdentity(ctx context.Context, email string) (bool, error) {
+	defer stats.Calls.Time("kratos", "identity_lookup")()
+
+	url := *config.AppConfig.Kratos.AdminAPI + "/admin/identities?email=" + email
+	client := httpclient.Client("kratos", "identity_lookup")
 
 	var resp *http.Response
 	var err error
 	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err = client.Get(url)
-
-    		if err == nil && resp != nil && resp.StatusCode == 200 {
-    			break
-    		}
-    		if attempt < 3 {
-    			fmt.Printf("🔁 Retry %d: Kratos check sessions failed (status=%v, error=%v)\n", attempt, getStatus(resp), err)
-    			time.Sleep(100 * time.Millisecond)
-    		}
-    	}
-
-    	if err != nil || resp == nil {
-    		fmt.Printf("❌   Final failure: Kratos check sessions after 3 attempts. Error: %v\n", err)
-    		return false, err
-    	}
-    	defer resp.Body.Close()
-
-    	if resp.StatusCode != 200 {
-    		body, _ := io.ReadAll(resp.Body)
-    		fmt.Printf("⚠️  Unexpected status from Kratos: %d\nResponse body: %s\n", resp.StatusCode, string(body))
-    		return false, errors.New("⚠️  Unexpected status from Kratos")
-    	}
-
-        checkIdentityResponse := make([]CheckIdentityResponse, 1)
-    	body, e1 := io.ReadAll(resp.Body)
-        if e1 != nil {
-            fmt.Printf("❌   Error reading response body: %v\n", e1)
-            return false, e1
-        }
-        e2 := json.Unmarshal([]byte(body), &checkIdentityResponse)
-        if e2 != nil {
-            fmt.Printf("❌   Error decoding check identity response: %v\n", e2)
-            return false, e2
-        }
-        firstIdentity := checkIdentityResponse[0]
-
-        if firstIdentity.State == "active" {
-                return true, nil
-        }
-
-        return false, nil
+		req, e := http.NewRequestWithContext(events.WithAttempt(ctx, attempt), http.MethodGet, url, nil)
+		if e != nil {
+			return false, fmt.Errorf("failed to build request: %w", e)
+		}
+		resp, err = client.Do(req)
+
+		if err == nil && resp != nil && resp.StatusCode == 200 {
+			break
+		}
+		if attempt < 3 {
+			logging.From(ctx).Warn("🔁 Kratos check sessions failed, retrying", "op", "identity_lookup", "attempt", attempt, "status", getStatus(resp), "error", err)
+			metrics.From(ctx).RetryCounter.WithLabelValues("kratos", "identity_lookup").Inc()
+			if e := httpclient.Backoff(ctx, resp); e != nil {
+				return false, e
+			}
+		}
+	}
+
+	if err != nil || resp == nil {
+		logging.From(ctx).Error("❌ Final failure: Kratos check sessions after 3 attempts", "op", "identity_lookup", "error", err)
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		logging.From(ctx).Error("⚠️  Unexpected status from Kratos", "op", "identity_lookup", "status", resp.StatusCode, "body", string(body))
+		return false, errors.New("⚠️  Unexpected status from Kratos")
+	}
+
+	checkIdentityResponse := make([]CheckIdentityResponse, 1)
+	body, e1 := io.ReadAll(resp.Body)
+	if e1 != nil {
+		logging.From(ctx).Error("❌ Error reading response body", "op", "identity_lookup", "error", e1)
+		return false, e1
+	}
+	e2 := json.Unmarshal([]byte(body), &checkIdentityResponse)
+	if e2 != nil {
+		logging.From(ctx).Error("❌ Error decoding check identity response", "op", "identity_lookup", "error", e2)
+		return false, e2
+	}
+	if len(checkIdentityResponse) == 0 {
+		return false, nil
+	}
+	firstIdentity := checkIdentityResponse[0]
+
+	if firstIdentity.State == "active" {
+		return true, nil
+	}
+
+	return false, nil
 }
 
-func RegisterIdentity(email, firstName, lastName, password string) (bool, error) {
+func RegisterIdentity(ctx context.Context, email, firstName, lastName, password string) (bool, error) {
 	var err error
-    regFlowId, err := createRegistrationFlow()
-    if err != nil || regFlowId == "" {
-        fmt.Printf("❌   Cannot get a registration flowID from Kratos. Error: %v\n", err)
-        return false, err
-    }
-
-    created, err := registrationIdentity(regFlowId, email, firstName, lastName, password)
-    if err != nil || !created {
-        fmt.Printf("❌   Cannot get a create an identity for %s. Error: %v\n", email, err)
-        return false, err
-    }
-
-    return created, nil
+	regFlowId, err := createRegistrationFlow(ctx)
+	if err != nil || regFlowId == "" {
+		logging.From(ctx).Error("❌ Cannot get a registration flowID from Kratos", "op", "registration", "error", err)
+		return false, err
+	}
+
+	created, err := registrationIdentity(ctx, regFlowId, email, firstName, lastName, password)
+	if err != nil || !created {
+		logging.From(ctx).Error("❌ Cannot create an identity", "op", "registration", "email", email, "error", err)
+		return false, err
+	}
+
+	return created, nil
 }
 
 func getStatus(resp *http.Response) int {
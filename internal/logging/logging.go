@@ -0,0 +1,268 @@
+// Package logging sets up the levelled log/slog logger of a run. The
+// standard log package is redirected to it too, so that every line, from
+// the summaries to the Ory clients' retries, honours -log-format,
+// -log-file and -verbose alike. -log-level only filters slog records: the
+// summaries and reports printed with the log package are always written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configure the logger of a run.
+type Options struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string
+	// Format is text (the default) or json.
+	Format string
+	// Rate caps the records of each Ory operation, e.g. keto check
+	// retries, logged per second; 0 disables the limit.
+	Rate int
+}
+
+// levelOutput is the level of the lines printed with the log package,
+// above every level -log-level accepts so that they are never filtered.
+// Handlers write it as info.
+const levelOutput = slog.LevelError + 4
+
+// Setup installs the logger configured by opts, writing to w, as the
+// default slog and log logger.
+func Setup(w io.Writer, opts Options) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: expected debug, info, warn or error", opts.Level)
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		h = &textHandler{out: &output{w: w}, level: level}
+	case "json":
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: outputAsInfo})
+	default:
+		return nil, fmt.Errorf("invalid log format %q: expected text or json", opts.Format)
+	}
+	if opts.Rate > 0 {
+		h = &limiter{next: h, rate: opts.Rate, state: &limits{windows: map[string]*window{}}}
+	}
+
+	l := slog.New(h)
+	slog.SetDefault(l)
+	slog.SetLogLoggerLevel(levelOutput)
+	return l, nil
+}
+
+// outputAsInfo reports the level of log package lines as info.
+func outputAsInfo(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.LevelKey && a.Value.Any() == levelOutput {
+		a.Value = slog.StringValue(slog.LevelInfo.String())
+	}
+	return a
+}
+
+// Suppressed returns the number of records dropped by the rate limit.
+func Suppressed() int64 {
+	return suppressed.Load()
+}
+
+type contextKey struct{}
+
+// With returns a context carrying l, for the Ory clients to log with.
+func With(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// From returns the logger carried by ctx, or the default logger.
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// output serializes the writes of handlers sharing a writer.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// textHandler writes records in the classic log format, e.g.
+//
+//	2025/06/01 10:00:00 WARN 🔁 Keto check failed, retrying service=keto op=check attempt=1
+//
+// omitting the level of info and log package records, so that summaries
+// read as before.
+type textHandler struct {
+	out    *output
+	level  slog.Level
+	attrs  string // preformatted attributes added by WithAttrs
+	prefix string // group prefix of attribute keys
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	if r.Level != slog.LevelInfo && r.Level != levelOutput {
+		b.WriteString(r.Level.String())
+		b.WriteByte(' ')
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	_, err := io.WriteString(h.out.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		appendAttr(&b, h.prefix, a)
+	}
+	c := *h
+	c.attrs += b.String()
+	return &c
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix += name + "."
+	return &c
+}
+
+// appendAttr writes a as " key=value", quoting values that contain spaces.
+func appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p += a.Key + "."
+		}
+		for _, g := range a.Value.Group() {
+			appendAttr(b, p, g)
+		}
+		return
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = fmt.Sprintf("%q", v)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, v)
+}
+
+var suppressed atomic.Int64
+
+// limiter passes at most rate records per second for each level, service
+// and Ory operation, identified by the "service" and "op" attributes.
+// Records without an "op" attribute, such as summaries, are never limited.
+// The first record let through after others were dropped carries their
+// number as "suppressed".
+type limiter struct {
+	next  slog.Handler
+	rate  int
+	state *limits
+	// service and op are the attributes added by WithAttrs, if any.
+	service, op string
+}
+
+type limits struct {
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// window counts the records of one key in the current second.
+type window struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+func (l *limiter) Enabled(ctx context.Context, level slog.Level) bool {
+	return l.next.Enabled(ctx, level)
+}
+
+func (l *limiter) Handle(ctx context.Context, r slog.Record) error {
+	service, op := l.service, l.op
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "service":
+			service = a.Value.String()
+		case "op":
+			op = a.Value.String()
+		}
+		return true
+	})
+	if op == "" {
+		return l.next.Handle(ctx, r)
+	}
+
+	key := r.Level.String() + "/" + service + "/" + op
+	l.state.mu.Lock()
+	w := l.state.windows[key]
+	if w == nil {
+		w = &window{}
+		l.state.windows[key] = w
+	}
+	if r.Time.Sub(w.start) >= time.Second {
+		w.start, w.count = r.Time, 0
+	}
+	w.count++
+	if w.count > l.rate {
+		w.suppressed++
+		l.state.mu.Unlock()
+		suppressed.Add(1)
+		return nil
+	}
+	dropped := w.suppressed
+	w.suppressed = 0
+	l.state.mu.Unlock()
+
+	if dropped > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", dropped))
+	}
+	return l.next.Handle(ctx, r)
+}
+
+func (l *limiter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *l
+	c.next = l.next.WithAttrs(attrs)
+	for _, a := range attrs {
+		switch a.Key {
+		case "service":
+			c.service = a.Value.String()
+		case "op":
+			c.op = a.Value.String()
+		}
+	}
+	return &c
+}
+
+func (l *limiter) WithGroup(name string) slog.Handler {
+	c := *l
+	c.next = l.next.WithGroup(name)
+	return &c
+}
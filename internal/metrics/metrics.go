@@ -1,71 +1,273 @@
 package metrics
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"crdb-ory-load-test/internal/config"
 )
 
-var (
+// Collectors are the Prometheus collectors of one run. Start builds them
+// for its Server; the workers and Ory clients of the run find them in
+// their context (see With).
+type Collectors struct {
+	OAuthTokenCheckCounter   *prometheus.CounterVec
+	PermissionCheckCounter   *prometheus.CounterVec
+	IdentityCheckCounter     *prometheus.CounterVec
+	ServiceTimeHistogram     *prometheus.HistogramVec
+	ResponseTimeHistogram    *prometheus.HistogramVec
+	RequestDurationHistogram *prometheus.HistogramVec
+	InFlightGauge            *prometheus.GaugeVec
+	RetryCounter             *prometheus.CounterVec
+	WriteCounter             *prometheus.CounterVec
+	QueueDepthGauge          *prometheus.GaugeVec
+}
 
-	OAuthTokenCheckCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "token_check_total",
-			Help: "Total oauth token checks run",
-		},
-		[]string{"result"},
-	)
+// NewCollectors returns a new set of collectors, registered nowhere.
+func NewCollectors() *Collectors {
+	return &Collectors{
+		OAuthTokenCheckCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "token_check_total",
+				Help: "Total oauth token checks run",
+			},
+			[]string{"result"},
+		),
 
-	PermissionCheckCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "permission_check_total",
-			Help: "Total permission checks run",
-		},
-		[]string{"result"},
-	)
+		PermissionCheckCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "permission_check_total",
+				Help: "Total permission checks run",
+			},
+			[]string{"result"},
+		),
 
-	IdentityCheckCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "identity_check_total",
-			Help: "Total identity checks run",
-		},
-		[]string{"result"},
-	)
+		IdentityCheckCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "identity_check_total",
+				Help: "Total identity checks run",
+			},
+			[]string{"result"},
+		),
+
+		ServiceTimeHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "operation_service_time_seconds",
+				Help:    "Latency of Ory operations, measured from when the request was sent",
+				Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+			},
+			[]string{"service", "operation"},
+		),
+
+		ResponseTimeHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "operation_response_time_seconds",
+				Help:    "Latency of Ory operations, measured from their scheduled start (corrected for coordinated omission)",
+				Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+			},
+			[]string{"service", "operation"},
+		),
+
+		RequestDurationHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "ory_request_duration_seconds",
+				Help:    "Latency of HTTP requests to Ory APIs, per attempt",
+				Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+			},
+			[]string{"service", "operation", "endpoint", "status_class"},
+		),
+
+		InFlightGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ory_requests_in_flight",
+				Help: "HTTP requests to Ory APIs awaiting a response",
+			},
+			[]string{"service", "operation"},
+		),
+
+		RetryCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ory_request_retries_total",
+				Help: "Total retries of failed Ory API calls",
+			},
+			[]string{"service", "operation"},
+		),
+
+		WriteCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "write_total",
+				Help: "Total writes run",
+			},
+			[]string{"service", "operation", "result"},
+		),
+
+		QueueDepthGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "queue_depth",
+				Help: "Entities written and waiting to be read back",
+			},
+			[]string{"service"},
+		),
+	}
+}
+
+// Defaults for the metrics settings left unset.
+const (
+	DefaultAddress = "0.0.0.0:2112"
+	DefaultPath    = "/metrics"
 )
 
-func Init(scope string) {
-
-    switch (scope) {
-        case "hydra":
-            // Metrics from Hydra
-            prometheus.MustRegister(OAuthTokenCheckCounter)
-        case "kratos":
-            // Metrics from Kratos
-            prometheus.MustRegister(IdentityCheckCounter)
-        case "keto":
-            // Metrics from Keto
-            prometheus.MustRegister(PermissionCheckCounter)
-        default:
-            // Metrics from all
-            prometheus.MustRegister(OAuthTokenCheckCounter)
-            prometheus.MustRegister(IdentityCheckCounter)
-            prometheus.MustRegister(PermissionCheckCounter)
-    }
+// Checks returns the counter of the check results of service: tokens for
+// hydra, identities for kratos and permissions for keto.
+func (c *Collectors) Checks(service string) *prometheus.CounterVec {
+	switch service {
+	case "hydra":
+		return c.OAuthTokenCheckCounter
+	case "kratos":
+		return c.IdentityCheckCounter
+	default:
+		return c.PermissionCheckCounter
+	}
+}
+
+// registered returns the collectors a run of scope exposes.
+func (c *Collectors) registered(scope string) []prometheus.Collector {
+	var cs []prometheus.Collector
+	switch scope {
+	case "hydra":
+		// Metrics from Hydra
+		cs = append(cs, c.OAuthTokenCheckCounter)
+	case "kratos":
+		// Metrics from Kratos
+		cs = append(cs, c.IdentityCheckCounter)
+	case "keto":
+		// Metrics from Keto
+		cs = append(cs, c.PermissionCheckCounter)
+	default:
+		// Metrics from all
+		cs = append(cs, c.OAuthTokenCheckCounter, c.IdentityCheckCounter, c.PermissionCheckCounter)
+	}
+
+	return append(cs,
+		// Latency metrics, labelled by service
+		c.ServiceTimeHistogram,
+		c.ResponseTimeHistogram,
+		// Request, write and queue metrics, labelled by service
+		c.RequestDurationHistogram,
+		c.InFlightGauge,
+		c.RetryCounter,
+		c.WriteCounter,
+		c.QueueDepthGauge,
+	)
+}
+
+type contextKey struct{}
+
+// unregistered collects the metrics recorded without collectors in the
+// context, e.g. by health probes, which no run exposes.
+var unregistered = NewCollectors()
+
+// With returns a context carrying c, for the workers and Ory clients of a
+// run to record their metrics into.
+func With(ctx context.Context, c *Collectors) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// From returns the collectors carried by ctx, or collectors registered
+// nowhere.
+func From(ctx context.Context) *Collectors {
+	if c, ok := ctx.Value(contextKey{}).(*Collectors); ok {
+		return c
+	}
+	return unregistered
+}
+
+// Server holds the metrics of one run: a registry of its own, so that
+// runs in the same process do not clash, and the HTTP server exposing it.
+type Server struct {
+	Registry *prometheus.Registry
+	// Collectors are the collectors registered with Registry.
+	Collectors *Collectors
+	// URL is where the metrics are served, or "" when the endpoint is
+	// disabled.
+	URL string
+
+	srv  *http.Server
+	done chan struct{}
+}
+
+// Start registers new collectors of scope with a new registry, and serves
+// it as configured by cfg. labels, e.g. the run ID, are added to every
+// metric.
+func Start(scope string, cfg config.Metrics, labels map[string]string) (*Server, error) {
+	s := &Server{Registry: prometheus.NewRegistry(), Collectors: NewCollectors()}
+	reg := prometheus.WrapRegistererWith(labels, s.Registry)
+	for _, c := range s.Collectors.registered(scope) {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	if cfg.Enabled != nil && !*cfg.Enabled {
+		return s, nil
+	}
+
+	address, path := cfg.Address, cfg.Path
+	if address == "" {
+		address = DefaultAddress
+	}
+	if path == "" {
+		path = DefaultPath
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start metrics server: %w", err)
+	}
 
 	// Health and metrics endpoints
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	mux.Handle(path, promhttp.HandlerFor(s.Registry, promhttp.HandlerOpts{}))
 
-	http.Handle("/metrics", promhttp.Handler())
-
+	s.URL = "http://" + displayAddress(ln.Addr().(*net.TCPAddr)) + path
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	s.done = make(chan struct{})
 	go func() {
-		log.Println("📡 Starting metrics HTTP server on :2112")
-		if err := http.ListenAndServe("0.0.0.0:2112", nil); err != nil {
-			log.Fatalf("❌ Metrics server failed: %v", err)
+		defer close(s.done)
+		log.Printf("📡 Starting metrics HTTP server on %s", ln.Addr())
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("❌ Metrics server failed", "error", err)
 		}
 	}()
+	return s, nil
+}
+
+// Shutdown stops the HTTP server, if any, once in-flight scrapes complete
+// or ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s == nil || s.srv == nil {
+		return nil
+	}
+	err := s.srv.Shutdown(ctx)
+	<-s.done
+	return err
+}
+
+// displayAddress returns addr with a wildcard host replaced by localhost.
+func displayAddress(addr *net.TCPAddr) string {
+	if addr.IP.IsUnspecified() {
+		return net.JoinHostPort("localhost", strconv.Itoa(addr.Port))
+	}
+	return addr.String()
 }
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+// DefaultJob is the job label of pushed metrics unless configured.
+const DefaultJob = "crdb-ory-load-test"
+
+// Pusher sends the metrics of a run to a Pushgateway, a Prometheus
+// remote-write endpoint or both: every interval while the run is in
+// progress, and once more with the final values when stopped. Runs shorter
+// than a few scrape intervals are fully captured that way.
+type Pusher struct {
+	gatherer    prometheus.Gatherer
+	gateway     *push.Pusher
+	gatewayURL  string
+	remoteWrite string
+	labels      []label // job, added to remote-written series
+	client      *http.Client
+
+	runID string
+	stop  chan struct{}
+	done  sync.WaitGroup
+}
+
+// StartPush starts pushing the metrics of g, which carry a run_id label,
+// as configured by cfg. Pushgateway groups are keyed by job and runID, and
+// remote-written series get a job label. It returns nil when no target is
+// set.
+func StartPush(g prometheus.Gatherer, cfg config.MetricsPush, runID string) *Pusher {
+	if cfg.Pushgateway == "" && cfg.RemoteWrite == "" {
+		return nil
+	}
+	job := cfg.Job
+	if job == "" {
+		job = DefaultJob
+	}
+
+	p := &Pusher{
+		gatherer:    g,
+		gatewayURL:  cfg.Pushgateway,
+		remoteWrite: cfg.RemoteWrite,
+		labels:      []label{{"job", job}},
+		client:      &http.Client{Timeout: 10 * time.Second},
+		runID:       runID,
+		stop:        make(chan struct{}),
+	}
+	var targets []string
+	if cfg.Pushgateway != "" {
+		targets = append(targets, cfg.Pushgateway)
+		// The Pushgateway adds the grouping labels back to every metric.
+		p.gateway = push.New(cfg.Pushgateway, job).Gatherer(without(g, "run_id")).Grouping("run_id", runID).Client(p.client)
+	}
+	if cfg.RemoteWrite != "" {
+		targets = append(targets, cfg.RemoteWrite)
+	}
+	log.Printf("📤 Pushing metrics of run %s (job %s) to %s", runID, job, strings.Join(targets, " and "))
+
+	if cfg.IntervalSec > 0 {
+		p.done.Add(1)
+		go func() {
+			defer p.done.Done()
+			t := time.NewTicker(time.Duration(cfg.IntervalSec) * time.Second)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					p.push()
+				case <-p.stop:
+					return
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// Stop ends the periodic pushes and pushes the final metrics.
+func (p *Pusher) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.done.Wait()
+	if p.push() {
+		log.Printf("📤 Pushed final metrics of run %s", p.runID)
+	}
+}
+
+// push sends the current metrics to every target. It logs failures and
+// reports whether every push succeeded.
+func (p *Pusher) push() bool {
+	ok := true
+	if p.gateway != nil {
+		// Push replaces the whole group, so series of the run gone since
+		// the last push do not linger.
+		if err := p.gateway.Push(); err != nil {
+			slog.Warn("⚠️  Failed to push metrics", "url", p.gatewayURL, "error", err)
+			ok = false
+		}
+	}
+	if p.remoteWrite != "" {
+		if err := p.write(); err != nil {
+			slog.Warn("⚠️  Failed to remote-write metrics", "url", p.remoteWrite, "error", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// write sends the current metrics as a remote-write request.
+func (p *Pusher) write() error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(flatten(families, p.labels), time.Now().UnixMilli()))
+
+	req, err := http.NewRequest(http.MethodPost, p.remoteWrite, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// without returns a gatherer removing the label name from the metrics of
+// g, since the Pushgateway client refuses metrics carrying a grouping
+// label.
+func without(g prometheus.Gatherer, name string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		for _, mf := range families {
+			for _, m := range mf.GetMetric() {
+				labels := m.Label[:0]
+				for _, l := range m.Label {
+					if l.GetName() != name {
+						labels = append(labels, l)
+					}
+				}
+				m.Label = labels
+			}
+		}
+		return families, err
+	})
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"maps"
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+// testRegistry returns a registry holding a counter, a gauge and a
+// histogram, labelled with runID as Start does.
+func testRegistry(runID string) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"run_id": runID}, reg)
+
+	writes := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "write_total", Help: "Writes."}, []string{"service", "result"})
+	depth := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "queue_depth", Help: "Depth."}, []string{"service"})
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "latency_seconds", Help: "Latency.", Buckets: []float64{0.3, 1}}, []string{"service"})
+	wrapped.MustRegister(writes, depth, latency)
+
+	writes.WithLabelValues("keto", "success").Add(42)
+	writes.WithLabelValues("keto", "failure").Add(3)
+	depth.WithLabelValues("keto").Set(7)
+	for _, v := range []float64{0.25, 0.5, 2} {
+		latency.WithLabelValues("keto").Observe(v)
+	}
+	return reg
+}
+
+// wantSeries are the series of testRegistry, without the job and run_id
+// labels.
+var wantSeries = []Sample{
+	{Name: "latency_seconds_bucket", Labels: map[string]string{"service": "keto", "le": "+Inf"}, Value: 3},
+	{Name: "latency_seconds_bucket", Labels: map[string]string{"service": "keto", "le": "0.3"}, Value: 1},
+	{Name: "latency_seconds_bucket", Labels: map[string]string{"service": "keto", "le": "1"}, Value: 2},
+	{Name: "latency_seconds_count", Labels: map[string]string{"service": "keto"}, Value: 3},
+	{Name: "latency_seconds_sum", Labels: map[string]string{"service": "keto"}, Value: 2.75},
+	{Name: "queue_depth", Labels: map[string]string{"service": "keto"}, Value: 7},
+	{Name: "write_total", Labels: map[string]string{"service": "keto", "result": "failure"}, Value: 3},
+	{Name: "write_total", Labels: map[string]string{"service": "keto", "result": "success"}, Value: 42},
+}
+
+func TestPushRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target func(url string) config.MetricsPush
+	}{
+		{"pushgateway", func(url string) config.MetricsPush {
+			return config.MetricsPush{Pushgateway: url, Job: "ci"}
+		}},
+		{"remote write", func(url string) config.MetricsPush {
+			return config.MetricsPush{RemoteWrite: url + "/api/v1/write", Job: "ci"}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewReceiver("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			p := StartPush(testRegistry("run-1"), tc.target(r.URL), "run-1")
+			p.Stop()
+
+			if got := r.Pushes(); got != 1 {
+				t.Errorf("Pushes() = %d, want 1", got)
+			}
+			got := r.Samples()
+			if len(got) != len(wantSeries) {
+				t.Fatalf("received %d series, want %d: %v", len(got), len(wantSeries), got)
+			}
+			for i, want := range wantSeries {
+				want.Labels = maps.Clone(want.Labels)
+				want.Labels["job"], want.Labels["run_id"] = "ci", "run-1"
+				if got[i].String() != want.String() {
+					t.Errorf("series %d = %v, want %v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRequestRoundTrip(t *testing.T) {
+	in := []series{
+		{labels: []label{{"__name__", "up"}, {"job", "ci"}}, value: 1},
+		{labels: []label{{"__name__", "temperature"}, {"room", "é"}}, value: -12.5},
+		{labels: []label{{"__name__", "ratio"}}, value: math.Inf(1)},
+	}
+	out, err := decodeWriteRequest(encodeWriteRequest(in, 1700000000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("decoded %d series, want %d", len(out), len(in))
+	}
+	for i := range in {
+		if got, want := len(out[i].labels), len(in[i].labels); got != want {
+			t.Fatalf("series %d has %d labels, want %d", i, got, want)
+		}
+		for j, l := range in[i].labels {
+			if out[i].labels[j] != l {
+				t.Errorf("series %d label %d = %v, want %v", i, j, out[i].labels[j], l)
+			}
+		}
+		if out[i].value != in[i].value {
+			t.Errorf("series %d value = %g, want %g", i, out[i].value, in[i].value)
+		}
+		if out[i].timestamp != 1700000000000 {
+			t.Errorf("series %d timestamp = %d, want 1700000000000", i, out[i].timestamp)
+		}
+	}
+}
+
+func TestGroupingLabels(t *testing.T) {
+	got, err := groupingLabels("job/ci/run_id@base64/cnVuLzE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []label{{"job", "ci"}, {"run_id", "run/1"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("groupingLabels() = %v, want %v", got, want)
+	}
+	if _, err := groupingLabels("job/ci/run_id"); err == nil {
+		t.Error("groupingLabels() of an odd path succeeded, want an error")
+	}
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Sample is the latest value of one series received by a Receiver.
+type Sample struct {
+	Name string
+	// Labels include the job and grouping labels of Pushgateway pushes.
+	Labels map[string]string
+	Value  float64
+}
+
+// String formats s as in the Prometheus text format, e.g.
+// write_total{result="success",service="keto"} 42.
+func (s Sample) String() string {
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s=%q", name, s.Labels[name])
+	}
+	return fmt.Sprintf("%s{%s} %g", s.Name, strings.Join(names, ","), s.Value)
+}
+
+// Receiver is a local stand-in for both a Pushgateway and a Prometheus
+// remote-write endpoint. It keeps the latest value of every series it
+// receives in memory, so that tests and CI jobs can check what a run
+// pushed without running Prometheus.
+type Receiver struct {
+	// URL is the base URL of the receiver: point metrics.push.pushgateway
+	// at it, and metrics.push.remote_write at URL + "/api/v1/write".
+	URL string
+
+	mu      sync.Mutex
+	pushes  int
+	samples map[string]Sample
+
+	srv  *http.Server
+	done chan struct{}
+}
+
+// NewReceiver starts a receiver listening on address, e.g. 127.0.0.1:0.
+func NewReceiver(address string) (*Receiver, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start metrics receiver: %w", err)
+	}
+	r := &Receiver{URL: "http://" + ln.Addr().String(), samples: map[string]Sample{}, done: make(chan struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics/job/", r.handlePush)
+	mux.HandleFunc("/api/v1/write", r.handleWrite)
+	r.srv = &http.Server{Handler: mux}
+	go func() {
+		defer close(r.done)
+		_ = r.srv.Serve(ln)
+	}()
+	return r, nil
+}
+
+// Close stops the receiver.
+func (r *Receiver) Close() error {
+	err := r.srv.Close()
+	<-r.done
+	return err
+}
+
+// Pushes returns the number of pushes and remote writes received.
+func (r *Receiver) Pushes() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pushes
+}
+
+// Samples returns the latest value of every series received, sorted by
+// name and labels.
+func (r *Receiver) Samples() []Sample {
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.samples))
+	for k := range r.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]Sample, len(keys))
+	for i, k := range keys {
+		out[i] = r.samples[k]
+	}
+	r.mu.Unlock()
+	return out
+}
+
+func (r *Receiver) store(ss []series) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pushes++
+	for _, s := range ss {
+		sample := Sample{Labels: map[string]string{}, Value: s.value}
+		key := make([]string, 0, len(s.labels))
+		for _, l := range s.labels {
+			key = append(key, l.name+"="+l.value)
+			if l.name == "__name__" {
+				sample.Name = l.value
+			} else {
+				sample.Labels[l.name] = l.value
+			}
+		}
+		sort.Strings(key)
+		r.samples[sample.Name+"{"+strings.Join(key, ",")+"}"] = sample
+	}
+}
+
+// handlePush accepts the pushes of a Pushgateway client, to
+// /metrics/job/<job>{/<label>/<value>}.
+func (r *Receiver) handlePush(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut && req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	grouping, err := groupingLabels(strings.TrimPrefix(req.URL.Path, "/metrics/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var families []*dto.MetricFamily
+	dec := expfmt.NewDecoder(req.Body, expfmt.ResponseFormat(req.Header))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		families = append(families, mf)
+	}
+	r.store(flatten(families, grouping))
+	w.WriteHeader(http.StatusOK)
+}
+
+// groupingLabels parses the job and grouping labels of a Pushgateway path
+// such as job/<job>/run_id/<id>. Values may be base64 encoded, with the
+// label name suffixed by @base64.
+func groupingLabels(path string) ([]label, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts)%2 != 0 {
+		return nil, fmt.Errorf("invalid grouping path %q", path)
+	}
+	var out []label
+	for i := 0; i < len(parts); i += 2 {
+		name, value := parts[i], parts[i+1]
+		if n, ok := strings.CutSuffix(name, "@base64"); ok {
+			v, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value of %s: %w", n, err)
+			}
+			name, value = n, string(v)
+		}
+		out = append(out, label{name, value})
+	}
+	return out, nil
+}
+
+// handleWrite accepts Prometheus remote-write requests.
+func (r *Receiver) handleWrite(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "remote write expects POST", http.StatusMethodNotAllowed)
+		return
+	}
+	compressed, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, "invalid snappy body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ss, err := decodeWriteRequest(body)
+	if err != nil {
+		http.Error(w, "invalid write request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.store(ss)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// label is a name/value pair of a time series.
+type label struct {
+	name, value string
+}
+
+// series is one sample of a time series, as remote write sends it.
+type series struct {
+	labels    []label // sorted by name, __name__ included
+	value     float64
+	timestamp int64 // milliseconds since the epoch
+}
+
+// flatten turns metric families into series the way Prometheus stores
+// them: histograms become _bucket, _sum and _count series, summaries
+// quantile, _sum and _count series. extra labels are added to every series.
+func flatten(families []*dto.MetricFamily, extra []label) []series {
+	var out []series
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			base := append([]label(nil), extra...)
+			for _, lp := range m.GetLabel() {
+				base = append(base, label{lp.GetName(), lp.GetValue()})
+			}
+			add := func(suffix string, value float64, more ...label) {
+				ls := append(append([]label{{"__name__", name + suffix}}, base...), more...)
+				sort.Slice(ls, func(i, j int) bool { return ls[i].name < ls[j].name })
+				out = append(out, series{labels: ls, value: value})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				add("_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			default:
+				add("", m.GetUntyped().GetValue())
+			}
+		}
+	}
+	return out
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes ss, stamped at timestamp, as a remote-write
+// WriteRequest protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(ss []series, timestamp int64) []byte {
+	var req []byte
+	for _, s := range ss {
+		var ts []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// decodeWriteRequest decodes a WriteRequest encoded as by
+// encodeWriteRequest, one series per sample. Unknown fields are skipped.
+func decodeWriteRequest(b []byte) ([]series, error) {
+	var out []series
+	err := fields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var labels []label
+		var samples []series
+		err := fields(v, func(num protowire.Number, v []byte) error {
+			switch num {
+			case 1:
+				var l label
+				err := fields(v, func(num protowire.Number, v []byte) error {
+					switch num {
+					case 1:
+						l.name = string(v)
+					case 2:
+						l.value = string(v)
+					}
+					return nil
+				})
+				labels = append(labels, l)
+				return err
+			case 2:
+				var s series
+				err := fields(v, func(num protowire.Number, v []byte) error {
+					switch num {
+					case 1:
+						if len(v) != 8 {
+							return fmt.Errorf("invalid sample value")
+						}
+						bits, _ := protowire.ConsumeFixed64(v)
+						s.value = math.Float64frombits(bits)
+					case 2:
+						n, _ := protowire.ConsumeVarint(v)
+						s.timestamp = int64(n)
+					}
+					return nil
+				})
+				samples = append(samples, s)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, s := range samples {
+			s.labels = labels
+			out = append(out, s)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// fields calls fn with the number and raw value of every field of the
+// protobuf message b: the payload of length-delimited fields, or the
+// encoded varint or fixed-size value of the others.
+func fields(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			payload, m := protowire.ConsumeBytes(b)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			v, n = payload, m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			v = b[:n]
+		}
+		if err := fn(num, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"crdb-ory-load-test/internal/events"
+	"crdb-ory-load-test/internal/stats"
+)
+
+// instrumentedTransport records every HTTP request an Ory client sends
+// into the collectors of its context: requests in flight, and their
+// latency by endpoint and status class. The
+// status classes are also tallied in stats.Calls for the run report, and
+// each request is recorded to the events file, if any.
+type instrumentedTransport struct {
+	service   string
+	operation string
+	next      http.RoundTripper
+}
+
+// Transport returns an http.RoundTripper instrumenting the requests of one
+// Ory API call, e.g. Transport("keto", "check", t), sent through next.
+func Transport(service, operation string, next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{service: service, operation: operation, next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m := From(req.Context())
+	inFlight := m.InFlightGauge.WithLabelValues(t.service, t.operation)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+	class := statusClass(resp, err)
+	m.RequestDurationHistogram.WithLabelValues(t.service, t.operation, req.URL.Path, class).
+		Observe(elapsed.Seconds())
+	stats.Calls.Status(t.service, t.operation, class)
+
+	if events.Enabled() {
+		worker, attempt, entities := events.From(req.Context())
+		e := events.Event{
+			Time:      start,
+			Service:   t.service,
+			Operation: t.operation,
+			Method:    req.Method,
+			Endpoint:  req.URL.Path,
+			Worker:    worker,
+			Attempt:   attempt,
+			LatencyMs: float64(elapsed.Microseconds()) / 1000,
+			Error:     errorClass(req, resp, err),
+			Entities:  entities,
+		}
+		if resp != nil {
+			e.Status = resp.StatusCode
+		}
+		events.Record(e)
+	}
+	return resp, err
+}
+
+// statusClass returns "2xx", "4xx"... for a response, or "error" when no
+// response came back.
+func statusClass(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", resp.StatusCode/100)
+}
+
+// errorClass returns why a request failed, or "" if it did not: "4xx" or
+// "5xx" for error responses, "timeout", "connection" (refused or reset),
+// "canceled" or "error" when no response came back.
+func errorClass(req *http.Request, resp *http.Response, err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil && resp != nil && resp.StatusCode < 400:
+		return ""
+	case err == nil && resp != nil:
+		return statusClass(resp, nil)
+	// A client timeout may surface as a cancelled request.
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(req.Context().Err(), context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return "connection"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,307 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed html.tmpl
+var htmlTemplate string
+
+// Chart geometry, in SVG user units.
+const (
+	chartWidth  = 760
+	chartHeight = 260
+	marginLeft  = 64
+	marginRight = 12
+	marginTop   = 12
+	marginBot   = 36
+)
+
+// palette colors the series of a chart, in order.
+var palette = []string{"#2563eb", "#dc2626", "#16a34a", "#d97706", "#7c3aed", "#0891b2", "#db2777", "#4b5563"}
+
+// WriteHTML writes the report to path as a single HTML page with charts of
+// throughput, latency and errors over time, for people rather than tools.
+// Charts are inline SVG, so the page needs no script or network access.
+func (r *Report) WriteHTML(path string) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"ms":      func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+		"rate":    func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) },
+		"percent": func(failed, count int64) string { return strconv.FormatFloat(percent(failed, count), 'f', 2, 64) },
+	}).Parse(htmlTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML report template: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create HTML report: %w", err)
+	}
+	defer f.Close()
+	if err := tmpl.Execute(f, newHTMLView(r)); err != nil {
+		return fmt.Errorf("failed to write HTML report %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+type htmlView struct {
+	*Report
+	Services []htmlService
+}
+
+type htmlService struct {
+	Service
+	Totals     []Operation
+	Throughput template.HTML
+	Errors     template.HTML
+	Ops        []htmlOperation
+	Calls      []htmlCall
+	// Sampled is set when the service has interval samples to chart.
+	Sampled bool
+}
+
+type htmlOperation struct {
+	Operation
+	Percentiles template.HTML
+	Histogram   template.HTML
+	Heatmap     template.HTML
+}
+
+type htmlCall struct {
+	Call
+	Statuses string
+}
+
+func newHTMLView(r *Report) htmlView {
+	v := htmlView{Report: r}
+	for _, s := range r.Services {
+		hs := htmlService{Service: s, Totals: []Operation{s.Reads, s.Writes}, Sampled: len(s.Intervals) > 0}
+		byOp := map[string][]Interval{}
+		for _, i := range s.Intervals {
+			byOp[i.Operation] = append(byOp[i.Operation], i)
+		}
+
+		var throughput, errors []series
+		for _, o := range s.Operations {
+			samples := byOp[o.Name]
+			throughput = append(throughput, intervalSeries(o.Name, samples, func(i Interval) float64 { return i.Throughput }))
+			errors = append(errors, intervalSeries(o.Name, samples, func(i Interval) float64 { return float64(i.Errors) }))
+
+			op := htmlOperation{Operation: o, Histogram: barChart(o.ResponseTime.Histogram)}
+			if len(samples) > 0 {
+				op.Percentiles = lineChart("ms", []series{
+					intervalSeries("p50", samples, func(i Interval) float64 { return i.Latency.P50 }),
+					intervalSeries("p95", samples, func(i Interval) float64 { return i.Latency.P95 }),
+					intervalSeries("p99", samples, func(i Interval) float64 { return i.Latency.P99 }),
+					intervalSeries("max", samples, func(i Interval) float64 { return i.Latency.Max }),
+				})
+				op.Heatmap = heatmap(samples)
+			}
+			hs.Ops = append(hs.Ops, op)
+		}
+		if hs.Sampled {
+			hs.Throughput = lineChart("ops/s", throughput)
+			hs.Errors = lineChart("errors", errors)
+		}
+
+		for _, c := range s.Calls {
+			classes := make([]string, 0, len(c.Statuses))
+			for class := range c.Statuses {
+				classes = append(classes, class)
+			}
+			sort.Strings(classes)
+			for i, class := range classes {
+				classes[i] = fmt.Sprintf("%s: %d", class, c.Statuses[class])
+			}
+			hs.Calls = append(hs.Calls, htmlCall{Call: c, Statuses: strings.Join(classes, ", ")})
+		}
+		v.Services = append(v.Services, hs)
+	}
+	return v
+}
+
+func percent(failed, count int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return 100 * float64(failed) / float64(count)
+}
+
+// series is one line of a chart.
+type series struct {
+	name   string
+	points [][2]float64
+}
+
+// intervalSeries plots value of each sample against the end of its
+// interval, in seconds since the start of the run.
+func intervalSeries(name string, samples []Interval, value func(Interval) float64) series {
+	s := series{name: name}
+	for _, i := range samples {
+		s.points = append(s.points, [2]float64{i.ElapsedSec, value(i)})
+	}
+	return s
+}
+
+// lineChart draws ss against elapsed seconds, with unit on the y axis.
+func lineChart(unit string, ss []series) template.HTML {
+	var maxX, maxY float64
+	for _, s := range ss {
+		for _, p := range s.points {
+			maxX, maxY = math.Max(maxX, p[0]), math.Max(maxY, p[1])
+		}
+	}
+	// Time spans the whole run; only the y axis is rounded up.
+	maxX, maxY = math.Max(maxX, 1), niceCeil(maxY)
+	x := func(v float64) float64 { return marginLeft + v/maxX*(chartWidth-marginLeft-marginRight) }
+	y := func(v float64) float64 { return chartHeight - marginBot - v/maxY*(chartHeight-marginTop-marginBot) }
+
+	var b strings.Builder
+	openSVG(&b)
+	axes(&b, maxX, maxY, "s", unit)
+	for i, s := range ss {
+		color := palette[i%len(palette)]
+		pts := make([]string, len(s.points))
+		for j, p := range s.points {
+			pts[j] = fmt.Sprintf("%.1f,%.1f", x(p[0]), y(p[1]))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.8" points="%s"><title>%s</title></polyline>`,
+			color, strings.Join(pts, " "), template.HTMLEscapeString(s.name))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/><text x="%d" y="%d" class="legend">%s</text>`,
+			chartWidth-150, marginTop+4+16*i, color, chartWidth-134, marginTop+13+16*i, template.HTMLEscapeString(s.name))
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// barChart draws a latency histogram with one bar per bucket of
+// HistogramBoundsMs.
+func barChart(counts []int64) template.HTML {
+	if len(counts) == 0 {
+		return ""
+	}
+	var maxY float64
+	for _, c := range counts {
+		maxY = math.Max(maxY, float64(c))
+	}
+	maxY = niceCeil(maxY)
+	width := float64(chartWidth-marginLeft-marginRight) / float64(len(counts))
+
+	var b strings.Builder
+	openSVG(&b)
+	axes(&b, 0, maxY, "", "count")
+	for i, c := range counts {
+		h := float64(c) / maxY * (chartHeight - marginTop - marginBot)
+		x := marginLeft + float64(i)*width
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>≤ %s ms: %d</title></rect>`,
+			x+1, chartHeight-marginBot-h, width-2, h, palette[0], formatBound(HistogramBoundsMs[i]), c)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="tick" text-anchor="middle">%s</text>`,
+			x+width/2, chartHeight-marginBot+14, formatBound(HistogramBoundsMs[i]))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" class="tick" text-anchor="middle">response time ≤ ms</text>`,
+		(chartWidth+marginLeft)/2, chartHeight-4)
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// heatmap draws the latency distribution of each interval sample, one
+// column per sample and one row per bucket of HistogramBoundsMs, shaded by
+// the share of the sample's operations in the bucket.
+func heatmap(samples []Interval) template.HTML {
+	// Only show the buckets some sample has observations in.
+	lo, hi := len(HistogramBoundsMs), -1
+	for _, s := range samples {
+		for i, c := range s.Latency.Histogram {
+			if c > 0 {
+				lo, hi = min(lo, i), max(hi, i)
+			}
+		}
+	}
+	if hi < 0 {
+		return ""
+	}
+
+	rows := hi - lo + 1
+	width := float64(chartWidth-marginLeft-marginRight) / float64(len(samples))
+	height := float64(chartHeight-marginTop-marginBot) / float64(rows)
+
+	var b strings.Builder
+	openSVG(&b)
+	for col, s := range samples {
+		for i := lo; i <= hi && i < len(s.Latency.Histogram); i++ {
+			c := s.Latency.Histogram[i]
+			if c == 0 {
+				continue
+			}
+			share := float64(c) / float64(s.Latency.Count)
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" fill-opacity="%.2f"><title>%.0fs, ≤ %s ms: %d (%.1f%%)</title></rect>`,
+				marginLeft+float64(col)*width, chartHeight-marginBot-float64(i-lo+1)*height, width, height,
+				palette[1], 0.1+0.9*share, s.ElapsedSec, formatBound(HistogramBoundsMs[i]), c, 100*share)
+		}
+	}
+	for i := lo; i <= hi; i++ {
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="tick" text-anchor="end">≤ %s ms</text>`,
+			marginLeft-6, chartHeight-marginBot-float64(i-lo)*height-height/2+4, formatBound(HistogramBoundsMs[i]))
+	}
+	last := samples[len(samples)-1].ElapsedSec
+	fmt.Fprintf(&b, `<text x="%d" y="%d" class="tick">0s</text><text x="%d" y="%d" class="tick" text-anchor="end">%.0fs</text>`,
+		marginLeft, chartHeight-marginBot+14, chartWidth-marginRight, chartHeight-marginBot+14, last)
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+func openSVG(b *strings.Builder) {
+	fmt.Fprintf(b, `<svg viewBox="0 0 %d %d" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+}
+
+// axes draws the axes with 5 ticks on y up to maxY and, unless maxX is
+// zero, on x up to maxX.
+func axes(b *strings.Builder, maxX, maxY float64, xUnit, yUnit string) {
+	bottom, right := chartHeight-marginBot, chartWidth-marginRight
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/><line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`,
+		marginLeft, marginTop, marginLeft, bottom, marginLeft, bottom, right, bottom)
+	for i := 0; i <= 5; i++ {
+		v := maxY * float64(i) / 5
+		yy := float64(bottom) - float64(i)/5*float64(chartHeight-marginTop-marginBot)
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/><text x="%d" y="%.1f" class="tick" text-anchor="end">%s</text>`,
+			marginLeft, yy, right, yy, marginLeft-6, yy+4, formatBound(v))
+		if maxX > 0 {
+			xx := marginLeft + float64(i)/5*float64(right-marginLeft)
+			fmt.Fprintf(b, `<text x="%.1f" y="%d" class="tick" text-anchor="middle">%.0f%s</text>`,
+				xx, bottom+14, maxX*float64(i)/5, xUnit)
+		}
+	}
+	fmt.Fprintf(b, `<text x="12" y="%d" class="tick" transform="rotate(-90 12 %d)" text-anchor="middle">%s</text>`,
+		(marginTop+bottom)/2, (marginTop+bottom)/2, yUnit)
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten, so that axis
+// ticks fall on round values.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	p := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*p {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// formatBound formats an axis value with up to 4 significant digits.
+func formatBound(v float64) string {
+	if v >= 1000 {
+		return strconv.FormatFloat(math.Round(v), 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
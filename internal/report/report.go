@@ -0,0 +1,263 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"crdb-ory-load-test/internal/stats"
+)
+
+// SchemaVersion is bumped whenever a field of the report changes meaning
+// or is removed. Adding fields does not bump it.
+const SchemaVersion = 1
+
+// Report is the machine-readable outcome of a run, written with
+// -report-file. Durations are in seconds and latencies in milliseconds.
+type Report struct {
+	SchemaVersion int `json:"schema_version"`
+	// RunID identifies the run; its metrics carry it as the run_id label.
+	RunID string `json:"run_id"`
+	// Labels are the labels of the run, as set in the config file or with
+	// -label; its metrics carry them too.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Scope       string            `json:"scope"`
+	DryRun      bool              `json:"dry_run"`
+	StartedAt   time.Time         `json:"started_at"`
+	EndedAt     time.Time         `json:"ended_at"`
+	DurationSec float64           `json:"duration_sec"`
+	// Config is the effective config of the run, after environment and
+	// flag overrides, keyed as in the config file.
+	Config   map[string]any `json:"config"`
+	Services []Service      `json:"services"`
+	// Thresholds holds the outcome of the thresholds of the config.
+	Thresholds []Check `json:"thresholds,omitempty"`
+}
+
+// Service is the outcome of one service's workload.
+type Service struct {
+	Name        string    `json:"name"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	DurationSec float64   `json:"duration_sec"`
+	Concurrency int       `json:"concurrency"`
+	// Reads and Writes aggregate every read and write operation.
+	Reads  Operation `json:"reads"`
+	Writes Operation `json:"writes"`
+	// Positive and Negative count the outcomes of the service's check:
+	// active/inactive tokens or identities, allowed/denied permissions.
+	Positive int64 `json:"positive"`
+	Negative int64 `json:"negative"`
+	// Evicted counts entities dropped from the read queue unread.
+	Evicted    int64       `json:"evicted"`
+	Operations []Operation `json:"operations"`
+	Calls      []Call      `json:"calls"`
+	Stages     []Stage     `json:"stages,omitempty"`
+	// Intervals holds the samples taken every workload.interval_sec.
+	Intervals []Interval `json:"intervals,omitempty"`
+	// Aborted is why the circuit breaker aborted the service's run, if it
+	// did.
+	Aborted string `json:"aborted,omitempty"`
+}
+
+// Operation is the outcome of one workload operation (e.g. "check"), or of
+// all reads or writes.
+type Operation struct {
+	Name string `json:"name"`
+	// Count includes failed operations.
+	Count  int64 `json:"count"`
+	Failed int64 `json:"failed"`
+	// Throughput is Count per second of the service's duration.
+	Throughput float64 `json:"throughput"`
+	// TargetRate is the configured rate, if any.
+	TargetRate   float64 `json:"target_rate,omitempty"`
+	ServiceTime  Latency `json:"service_time"`
+	ResponseTime Latency `json:"response_time"`
+}
+
+// Call is one Ory API call, e.g. Kratos' "registration_flow".
+type Call struct {
+	Name       string  `json:"name"`
+	Count      int64   `json:"count"`
+	Throughput float64 `json:"throughput"`
+	// Statuses counts attempts, retries included, by HTTP status class
+	// ("2xx", "5xx"...) or "error" when no response came back.
+	Statuses map[string]int64 `json:"statuses"`
+	Latency  Latency          `json:"latency"`
+}
+
+// Stage is the outcome of one stage of workload.stages.
+type Stage struct {
+	Name         string  `json:"name"`
+	StartSec     float64 `json:"start_sec"`
+	EndSec       float64 `json:"end_sec"`
+	Reads        int64   `json:"reads"`
+	Writes       int64   `json:"writes"`
+	FailedReads  int64   `json:"failed_reads"`
+	FailedWrites int64   `json:"failed_writes"`
+	ReadLatency  Latency `json:"read_latency"`
+}
+
+// Interval is a sample of one operation over one reporting interval of a
+// run, with the cumulative values up to its end. Latencies are response
+// times.
+type Interval struct {
+	Service              string  `json:"service"`
+	Operation            string  `json:"operation"`
+	ElapsedSec           float64 `json:"elapsed_sec"`
+	IntervalSec          float64 `json:"interval_sec"`
+	Count                int64   `json:"count"`
+	Errors               int64   `json:"errors"`
+	Throughput           float64 `json:"throughput"`
+	CumulativeCount      int64   `json:"cumulative_count"`
+	CumulativeErrors     int64   `json:"cumulative_errors"`
+	CumulativeThroughput float64 `json:"cumulative_throughput"`
+	Latency              Latency `json:"latency"`
+	CumulativeLatency    Latency `json:"cumulative_latency"`
+}
+
+// HistogramBoundsMs are the upper bounds, in milliseconds, of the buckets
+// of Latency.Histogram. The last bucket also holds slower observations.
+var HistogramBoundsMs = []float64{
+	0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000,
+}
+
+// Latency summarizes a latency histogram, in milliseconds.
+type Latency struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min_ms"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+	P999  float64 `json:"p999_ms"`
+	Max   float64 `json:"max_ms"`
+	// Histogram counts the observations per bucket of HistogramBoundsMs.
+	Histogram []int64 `json:"histogram,omitempty"`
+}
+
+// NewLatency summarizes h.
+func NewLatency(h *stats.Histogram) Latency {
+	if h == nil || h.Count() == 0 {
+		return Latency{}
+	}
+	bounds := make([]time.Duration, len(HistogramBoundsMs))
+	for i, b := range HistogramBoundsMs {
+		bounds[i] = time.Duration(b * float64(time.Millisecond))
+	}
+	return Latency{
+		Count: h.Count(),
+		Min:   ms(h.Min()),
+		Mean:  ms(h.Mean()),
+		P50:   ms(h.Quantile(0.50)),
+		P90:   ms(h.Quantile(0.90)),
+		P95:   ms(h.Quantile(0.95)),
+		P99:   ms(h.Quantile(0.99)),
+		P999:  ms(h.Quantile(0.999)),
+		Max:   ms(h.Max()),
+
+		Histogram: h.Distribution(bounds),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteFile writes the report to path, as CSV if it ends in .csv and as
+// JSON otherwise.
+func (r *Report) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = r.writeCSV(f)
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// CSVHeader lists the columns of the CSV report. Each row is one total
+// (reads or writes), operation or Ory API call of a service. Latencies are
+// response times; for calls, failed counts the attempts without a 2xx
+// status.
+var CSVHeader = []string{
+	"scope", "started_at", "ended_at", "service", "kind", "name",
+	"count", "failed", "throughput",
+	"min_ms", "mean_ms", "p50_ms", "p90_ms", "p99_ms", "p999_ms", "max_ms",
+}
+
+func (r *Report) writeCSV(f *os.File) error {
+	w := csv.NewWriter(f)
+	if err := w.Write(CSVHeader); err != nil {
+		return err
+	}
+
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, s := range r.Services {
+		row := func(kind, name string, count, failed int64, throughput float64, l Latency) error {
+			return w.Write([]string{
+				r.Scope, r.StartedAt.Format(time.RFC3339), r.EndedAt.Format(time.RFC3339), s.Name, kind, name,
+				strconv.FormatInt(count, 10), strconv.FormatInt(failed, 10), num(throughput),
+				num(l.Min), num(l.Mean), num(l.P50), num(l.P90), num(l.P99), num(l.P999), num(l.Max),
+			})
+		}
+
+		for _, o := range []Operation{s.Reads, s.Writes} {
+			if err := row("total", o.Name, o.Count, o.Failed, o.Throughput, o.ResponseTime); err != nil {
+				return err
+			}
+		}
+		for _, o := range s.Operations {
+			if err := row("operation", o.Name, o.Count, o.Failed, o.Throughput, o.ResponseTime); err != nil {
+				return err
+			}
+		}
+		for _, c := range s.Calls {
+			var failed int64
+			for class, n := range c.Statuses {
+				if class != "2xx" {
+					failed += n
+				}
+			}
+			if err := row("call", c.Name, c.Count, failed, c.Throughput, c.Latency); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ReadFile reads a JSON report written by WriteFile.
+func ReadFile(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report: %w", err)
+	}
+	defer f.Close()
+
+	var r Report
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	if r.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("report %s has schema version %d, expected %d", path, r.SchemaVersion, SchemaVersion)
+	}
+	return &r, nil
+}
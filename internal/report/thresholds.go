@@ -0,0 +1,155 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+// Check is the outcome of one threshold of the config.
+type Check struct {
+	Threshold string  `json:"threshold"`
+	Service   string  `json:"service"`
+	Operation string  `json:"operation"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Passed    bool    `json:"passed"`
+	// Skipped is set on the thresholds of services the run left out, which
+	// neither pass nor fail.
+	Skipped bool `json:"skipped,omitempty"`
+	// Reason explains a failure or skip, e.g. when the operation never ran.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Evaluate checks every threshold against the services of a run of scope
+// (hydra, kratos, keto or all). The thresholds of services outside scope,
+// and all of them in a dry run, which calls no Ory API, are skipped.
+func Evaluate(thresholds []config.Threshold, scope string, dryRun bool, services []Service) []Check {
+	checks := make([]Check, 0, len(thresholds))
+	for _, t := range thresholds {
+		c := Check{Threshold: t.String(), Service: t.Service, Operation: t.Operation, Metric: t.Metric}
+		if dryRun {
+			c.Skipped, c.Reason = true, "dry run"
+			checks = append(checks, c)
+			continue
+		}
+		if scope != "all" && !strings.EqualFold(scope, t.Service) {
+			c.Skipped, c.Reason = true, fmt.Sprintf("%s is outside -scope %s", t.Service, scope)
+			checks = append(checks, c)
+			continue
+		}
+		op := findOperation(services, t.Service, t.Operation)
+		if op == nil {
+			c.Reason = "operation did not run"
+		} else {
+			c.Value = metricValue(*op, t.Metric)
+			c.Passed = (t.Below == nil || c.Value < *t.Below) && (t.Above == nil || c.Value > *t.Above)
+			if !c.Passed {
+				c.Reason = fmt.Sprintf("got %.3f", c.Value)
+			}
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// Passed reports whether every check passed or was skipped.
+func Passed(checks []Check) bool {
+	for _, c := range checks {
+		if !c.Passed && !c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+func findOperation(services []Service, service, operation string) *Operation {
+	for _, s := range services {
+		if !strings.EqualFold(s.Name, service) {
+			continue
+		}
+		for i := range s.Operations {
+			if s.Operations[i].Name == operation {
+				return &s.Operations[i]
+			}
+		}
+	}
+	return nil
+}
+
+func metricValue(o Operation, metric string) float64 {
+	l := o.ResponseTime
+	switch metric {
+	case "throughput":
+		return o.Throughput
+	case "error_rate":
+		if o.Count == 0 {
+			return 0
+		}
+		return 100 * float64(o.Failed) / float64(o.Count)
+	case "mean":
+		return l.Mean
+	case "p50":
+		return l.P50
+	case "p90":
+		return l.P90
+	case "p95":
+		return l.P95
+	case "p99":
+		return l.P99
+	case "p99.9":
+		return l.P999
+	default:
+		return l.Max
+	}
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitFailure `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the checks to path as a JUnit XML test suite, one test
+// case per threshold, so that CI systems show them with the other tests.
+func WriteJUnit(path string, checks []Check) error {
+	suite := junitSuite{Name: "crdb-ory-load-test thresholds", Tests: len(checks)}
+	for _, c := range checks {
+		tc := junitCase{Name: c.Threshold, ClassName: c.Service + "." + c.Operation}
+		switch {
+		case c.Skipped:
+			suite.Skipped++
+			tc.Skipped = &junitFailure{Message: c.Reason}
+		case !c.Passed:
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: c.Reason}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
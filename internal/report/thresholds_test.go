@@ -0,0 +1,146 @@
+package report
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"crdb-ory-load-test/internal/config"
+)
+
+// testServices is a keto run of 200 checks, 3 of them failed.
+var testServices = []Service{{
+	Name: "Keto",
+	Operations: []Operation{{
+		Name:         "check",
+		Count:        200,
+		Failed:       3,
+		Throughput:   50,
+		ResponseTime: Latency{Mean: 8, P50: 6, P99: 20, Max: 45},
+	}},
+}}
+
+// parseThresholds reads thresholds as the config file holds them.
+func parseThresholds(t *testing.T, doc string) []config.Threshold {
+	t.Helper()
+	var thresholds []config.Threshold
+	if err := yaml.Unmarshal([]byte(doc), &thresholds); err != nil {
+		t.Fatal(err)
+	}
+	return thresholds
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, tc := range []struct {
+		threshold string
+		name      string
+		value     float64
+		passed    bool
+		reason    string
+	}{
+		{"{service: keto, operation: check, metric: p99, below: 25}", "keto check p99 < 25", 20, true, ""},
+		{"{service: keto, operation: check, metric: p99, below: 20}", "keto check p99 < 20", 20, false, "got 20.000"},
+		{"{service: keto, operation: check, metric: p99, above: 20}", "keto check p99 > 20", 20, false, "got 20.000"},
+		{"{service: keto, operation: check, metric: mean, above: 7.5}", "keto check mean > 7.5", 8, true, ""},
+		{"{service: keto, operation: check, metric: max, below: 40}", "keto check max < 40", 45, false, "got 45.000"},
+		{"{service: keto, operation: check, metric: error_rate, below: 1.5}", "keto check error_rate < 1.5", 1.5, false, "got 1.500"},
+		{"{service: keto, operation: check, metric: error_rate, below: 2}", "keto check error_rate < 2", 1.5, true, ""},
+		{"{service: keto, operation: check, metric: throughput, above: 40, below: 60}", "keto check throughput > 40 and < 60", 50, true, ""},
+		{"{service: keto, operation: check, metric: throughput, above: 60, below: 80}", "keto check throughput > 60 and < 80", 50, false, "got 50.000"},
+		{"{service: keto, operation: expand, metric: p99, below: 10}", "keto expand p99 < 10", 0, false, "operation did not run"},
+	} {
+		checks := Evaluate(parseThresholds(t, "["+tc.threshold+"]"), "keto", false, testServices)
+		if len(checks) != 1 {
+			t.Fatalf("Evaluate(%s) returned %d checks, want 1", tc.threshold, len(checks))
+		}
+		c := checks[0]
+		if c.Threshold != tc.name || c.Value != tc.value || c.Passed != tc.passed || c.Skipped || c.Reason != tc.reason {
+			t.Errorf("Evaluate(%s) = %+v, want %q value %g passed %v reason %q", tc.threshold, c, tc.name, tc.value, tc.passed, tc.reason)
+		}
+	}
+}
+
+func TestEvaluateSkipped(t *testing.T) {
+	thresholds := parseThresholds(t, `
+- {service: keto, operation: check, metric: p99, below: 10}
+- {service: hydra, operation: grant, metric: p99, below: 10}
+`)
+	for _, tc := range []struct {
+		scope   string
+		dryRun  bool
+		skipped []bool
+		reason  string
+	}{
+		{"all", false, []bool{false, false}, ""},
+		{"keto", false, []bool{false, true}, "hydra is outside -scope keto"},
+		{"keto", true, []bool{true, true}, "dry run"},
+	} {
+		checks := Evaluate(thresholds, tc.scope, tc.dryRun, testServices)
+		for i, c := range checks {
+			if c.Skipped != tc.skipped[i] {
+				t.Errorf("scope %s, dry run %v: check %q skipped = %v, want %v", tc.scope, tc.dryRun, c.Threshold, c.Skipped, tc.skipped[i])
+			}
+			if c.Skipped && c.Reason != tc.reason {
+				t.Errorf("scope %s, dry run %v: check %q skipped for %q, want %q", tc.scope, tc.dryRun, c.Threshold, c.Reason, tc.reason)
+			}
+		}
+		// keto check p99 < 10 fails whenever it is checked.
+		if want := tc.dryRun; Passed(checks) != want {
+			t.Errorf("scope %s, dry run %v: Passed() = %v, want %v", tc.scope, tc.dryRun, Passed(checks), want)
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	checks := []Check{
+		{Threshold: "keto check p99 < 25", Service: "keto", Operation: "check", Passed: true},
+		{Threshold: "keto check p99 < 20", Service: "keto", Operation: "check", Reason: "got 20.000"},
+		{Threshold: "hydra grant p99 < 10", Service: "hydra", Operation: "grant", Skipped: true, Reason: "hydra is outside -scope keto"},
+	}
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := WriteJUnit(path, checks); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var suite junitSuite
+	if err := xml.Unmarshal(data, &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 {
+		t.Errorf("suite has %d tests, %d failures, %d skipped, want 3, 1, 1", suite.Tests, suite.Failures, suite.Skipped)
+	}
+	for i, tc := range []struct {
+		name, class      string
+		failure, skipped string
+	}{
+		{"keto check p99 < 25", "keto.check", "", ""},
+		{"keto check p99 < 20", "keto.check", "got 20.000", ""},
+		{"hydra grant p99 < 10", "hydra.grant", "", "hydra is outside -scope keto"},
+	} {
+		c := suite.Cases[i]
+		if c.Name != tc.name || c.ClassName != tc.class {
+			t.Errorf("case %d = %s (%s), want %s (%s)", i, c.Name, c.ClassName, tc.name, tc.class)
+		}
+		if got := message(c.Failure); got != tc.failure {
+			t.Errorf("case %d failure = %q, want %q", i, got, tc.failure)
+		}
+		if got := message(c.Skipped); got != tc.skipped {
+			t.Errorf("case %d skipped = %q, want %q", i, got, tc.skipped)
+		}
+	}
+}
+
+// message returns the message of f, or "" when there is none.
+func message(f *junitFailure) string {
+	if f == nil {
+		return ""
+	}
+	return f.Message
+}
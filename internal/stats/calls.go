@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Calls records every Ory API call made by the clients, by service and
+// call name, e.g. ("kratos", "registration_flow"): the latency of each call,
+// from its first attempt until its final outcome, retries included, and the
+// status class of each attempt.
+var Calls = &CallSet{}
+
+// CallSet holds the latencies and statuses of the calls to each service.
+// It is safe for concurrent use.
+type CallSet struct {
+	mu    sync.Mutex
+	calls map[string]map[string]*call
+}
+
+type call struct {
+	latency  *Histogram
+	statuses map[string]int64
+}
+
+// Time starts timing a call; the returned function records it, e.g.
+//
+//	defer stats.Calls.Time("keto", "check")()
+func (s *CallSet) Time(service, name string) func() {
+	start := time.Now()
+	return func() { s.Record(service, name, time.Since(start)) }
+}
+
+// Record adds one call of duration d.
+func (s *CallSet) Record(service, name string, d time.Duration) {
+	s.mu.Lock()
+	h := s.get(service, name).latency
+	s.mu.Unlock()
+	h.Record(d)
+}
+
+// Status counts one attempt of a call ending with the given status class,
+// e.g. "2xx", "5xx" or "error".
+func (s *CallSet) Status(service, name, class string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(service, name).statuses[class]++
+}
+
+// get returns the call, creating it if needed. s.mu must be held.
+func (s *CallSet) get(service, name string) *call {
+	if s.calls == nil {
+		s.calls = map[string]map[string]*call{}
+	}
+	if s.calls[service] == nil {
+		s.calls[service] = map[string]*call{}
+	}
+	c := s.calls[service][name]
+	if c == nil {
+		c = &call{latency: NewHistogram(), statuses: map[string]int64{}}
+		s.calls[service][name] = c
+	}
+	return c
+}
+
+// Names returns the calls recorded for service, sorted.
+func (s *CallSet) Names(service string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.calls[service]))
+	for name := range s.calls[service] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Histogram returns the latencies of one call, or nil if it never ran.
+func (s *CallSet) Histogram(service, name string) *Histogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.calls[service][name]; c != nil {
+		return c.latency
+	}
+	return nil
+}
+
+// Statuses returns the number of attempts of one call by status class.
+func (s *CallSet) Statuses(service, name string) map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := map[string]int64{}
+	if c := s.calls[service][name]; c != nil {
+		for class, n := range c.statuses {
+			statuses[class] = n
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Counter is an event counter safe for concurrent use. Workers increment
+// it without locking; it must not be copied once in use.
+type Counter struct {
+	n atomic.Int64
+}
+
+// Inc adds one event.
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add adds n events.
+func (c *Counter) Add(n int64) {
+	c.n.Add(n)
+}
+
+// Load returns the number of events so far.
+func (c *Counter) Load() int64 {
+	return c.n.Load()
+}
+
+// Throughput returns n events per second over elapsed, the wall-clock time
+// actually spent, or 0 before any time has elapsed.
+func Throughput(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Values are recorded in microseconds into log-linear buckets, the layout
+// used by HdrHistogram: values below subBuckets are exact, and every power
+// of two above is split into subBuckets/2 linear buckets, which bounds the
+// relative error to 1/(subBuckets/2), about 0.2%.
+const (
+	subBucketBits = 10
+	subBuckets    = 1 << subBucketBits
+	halfBuckets   = subBuckets / 2
+	// maxValue caps recorded values at ~1h; larger values land in the last bucket.
+	maxValue = int64(time.Hour / time.Microsecond)
+)
+
+var bucketCount = bucketIndex(maxValue) + 1
+
+// Histogram is a latency histogram safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	counts []int64
+	total  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, bucketCount)}
+}
+
+// Record adds one observation.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > maxValue {
+		v = maxValue
+	}
+
+	h.mu.Lock()
+	h.counts[bucketIndex(v)]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// Merge adds every observation of other to h.
+func (h *Histogram) Merge(other *Histogram) {
+	other.mu.Lock()
+	counts := append([]int64(nil), other.counts...)
+	total, sum, min, max := other.total, other.sum, other.min, other.max
+	other.mu.Unlock()
+	if total == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, c := range counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || min < h.min {
+		h.min = min
+	}
+	if max > h.max {
+		h.max = max
+	}
+	h.total += total
+	h.sum += sum
+}
+
+// Drain moves every observation of h into a new histogram and returns it,
+// leaving h empty. Observations recorded concurrently land either in the
+// returned histogram or in h, never in neither.
+func (h *Histogram) Drain() *Histogram {
+	out := NewHistogram()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts, out.counts = out.counts, h.counts
+	out.total, out.sum, out.min, out.max = h.total, h.sum, h.min, h.max
+	h.total, h.sum, h.min, h.max = 0, 0, 0, 0
+	return out
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Min returns the smallest observation.
+func (h *Histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest observation.
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the average observation.
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.total) * time.Microsecond
+}
+
+// Quantile returns the value at quantile q (0..1), e.g. 0.99 for p99.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	if q >= 1 {
+		return time.Duration(h.max) * time.Microsecond
+	}
+
+	// The rank of the smallest observation at or above q of them, as
+	// HdrHistogram computes it.
+	rank := max(1, int64(math.Ceil(q*float64(h.total))))
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := bucketUpper(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return time.Duration(h.max) * time.Microsecond
+}
+
+func bucketIndex(v int64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	return subBuckets + (shift-1)*halfBuckets + int(v>>shift) - halfBuckets
+}
+
+// bucketUpper returns the highest value that falls into bucket i.
+func bucketUpper(i int) int64 {
+	if i < subBuckets {
+		return int64(i)
+	}
+	shift := (i-subBuckets)/halfBuckets + 1
+	sub := int64((i-subBuckets)%halfBuckets + halfBuckets)
+	return (sub+1)<<shift - 1
+}
+
+// Distribution returns the number of observations falling into each of
+// the buckets ending at bounds, which must be increasing: the first bucket
+// holds the observations up to bounds[0], the next those up to bounds[1],
+// and so on. Observations above the last bound count in the last bucket.
+func (h *Histogram) Distribution(bounds []time.Duration) []int64 {
+	out := make([]int64, len(bounds))
+	if len(bounds) == 0 {
+		return out
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b := 0
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		v := time.Duration(bucketUpper(i)) * time.Microsecond
+		for b < len(bounds)-1 && v > bounds[b] {
+			b++
+		}
+		out[b] += c
+	}
+	return out
+}
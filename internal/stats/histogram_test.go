@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketIndex(t *testing.T) {
+	for v := int64(0); v < subBuckets; v++ {
+		if got := bucketIndex(v); got != int(v) {
+			t.Fatalf("bucketIndex(%d) = %d, want %d", v, got, v)
+		}
+	}
+	for _, tc := range []struct {
+		v    int64
+		want int
+	}{
+		{1024, 1024},
+		{1025, 1024},
+		{1026, 1025},
+		{2047, 1535},
+		{2048, 1536},
+		{2051, 1536},
+		{2052, 1537},
+	} {
+		if got := bucketIndex(tc.v); got != tc.want {
+			t.Errorf("bucketIndex(%d) = %d, want %d", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestBucketUpper(t *testing.T) {
+	for _, tc := range []struct {
+		i    int
+		want int64
+	}{
+		{0, 0},
+		{1023, 1023},
+		{1024, 1025},
+		{1535, 2047},
+		{1536, 2051},
+	} {
+		if got := bucketUpper(tc.i); got != tc.want {
+			t.Errorf("bucketUpper(%d) = %d, want %d", tc.i, got, tc.want)
+		}
+	}
+
+	// Every value falls into the bucket whose bounds hold it, and the
+	// bucket is at most 0.2% wide.
+	prev := int64(-1)
+	for i := 0; i < bucketCount; i++ {
+		upper := bucketUpper(i)
+		if upper <= prev {
+			t.Fatalf("bucketUpper(%d) = %d, not above bucketUpper(%d) = %d", i, upper, i-1, prev)
+		}
+		for _, v := range []int64{prev + 1, upper} {
+			if got := bucketIndex(v); got != i {
+				t.Fatalf("bucketIndex(%d) = %d, want %d", v, got, i)
+			}
+		}
+		if width := upper - prev; prev >= subBuckets && float64(width)/float64(prev) > 0.002 {
+			t.Fatalf("bucket %d is %d wide at %d, above 0.2%%", i, width, prev)
+		}
+		prev = upper
+	}
+	if prev < maxValue {
+		t.Fatalf("last bucket ends at %d, below maxValue %d", prev, maxValue)
+	}
+}
+
+// near reports whether got is within the histogram's 0.2% precision of want.
+func near(got, want time.Duration) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) <= 0.002*float64(want)
+}
+
+func TestQuantile(t *testing.T) {
+	h := NewHistogram()
+	for ms := 1; ms <= 100; ms++ {
+		h.Record(time.Duration(ms) * time.Millisecond)
+	}
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.01, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{0.999, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	} {
+		if got := h.Quantile(tc.q); !near(got, tc.want) {
+			t.Errorf("Quantile(%g) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+
+	two := NewHistogram()
+	two.Record(10 * time.Microsecond)
+	two.Record(20 * time.Microsecond)
+	if got := two.Quantile(0.5); got != 10*time.Microsecond {
+		t.Errorf("Quantile(0.5) of 10µs and 20µs = %v, want 10µs", got)
+	}
+
+	if got := NewHistogram().Quantile(0.5); got != 0 {
+		t.Errorf("Quantile(0.5) of an empty histogram = %v, want 0", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := NewHistogram(), NewHistogram()
+	for ms := 1; ms <= 50; ms++ {
+		a.Record(time.Duration(ms) * time.Millisecond)
+	}
+	for ms := 51; ms <= 100; ms++ {
+		b.Record(time.Duration(ms) * time.Millisecond)
+	}
+	a.Merge(b)
+	a.Merge(NewHistogram())
+
+	if got := a.Count(); got != 100 {
+		t.Errorf("Count() = %d, want 100", got)
+	}
+	if got := a.Min(); got != time.Millisecond {
+		t.Errorf("Min() = %v, want 1ms", got)
+	}
+	if got := a.Max(); got != 100*time.Millisecond {
+		t.Errorf("Max() = %v, want 100ms", got)
+	}
+	if got := a.Mean(); got != 50500*time.Microsecond {
+		t.Errorf("Mean() = %v, want 50.5ms", got)
+	}
+	if got := a.Quantile(0.5); !near(got, 50*time.Millisecond) {
+		t.Errorf("Quantile(0.5) = %v, want 50ms", got)
+	}
+
+	empty := NewHistogram()
+	empty.Merge(b)
+	if got := empty.Min(); got != 51*time.Millisecond {
+		t.Errorf("Min() after merging into an empty histogram = %v, want 51ms", got)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	h := NewHistogram()
+	h.Record(10 * time.Millisecond)
+	h.Record(30 * time.Millisecond)
+
+	d := h.Drain()
+	if got := d.Count(); got != 2 {
+		t.Errorf("Count() of the drained histogram = %d, want 2", got)
+	}
+	if got := d.Max(); got != 30*time.Millisecond {
+		t.Errorf("Max() of the drained histogram = %v, want 30ms", got)
+	}
+	if got := h.Count(); got != 0 {
+		t.Errorf("Count() after Drain = %d, want 0", got)
+	}
+
+	h.Record(20 * time.Millisecond)
+	if got, want := h.Quantile(0.5), h.Min(); got != want || !near(got, 20*time.Millisecond) {
+		t.Errorf("Quantile(0.5) after Drain = %v, want 20ms", got)
+	}
+	if got := d.Count(); got != 2 {
+		t.Errorf("Count() of the drained histogram after recording into h = %d, want 2", got)
+	}
+}
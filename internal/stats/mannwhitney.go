@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// MannWhitneyU returns the two-sided p-value of the Mann-Whitney U test of
+// whether samples a and b come from the same distribution. It makes no
+// assumption on the shape of the distribution, which suits per-interval
+// throughput and latency samples. It uses the normal approximation with
+// tie and continuity corrections, and returns 1 when either sample is
+// empty or all values are equal.
+func MannWhitneyU(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type value struct {
+		v     float64
+		first bool
+	}
+	values := make([]value, 0, len(a)+len(b))
+	for _, v := range a {
+		values = append(values, value{v, true})
+	}
+	for _, v := range b {
+		values = append(values, value{v, false})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].v < values[j].v })
+
+	// Rank the values, giving tied values their average rank.
+	var rankSum, ties float64
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if values[k].first {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 || math.IsNaN(sigma) {
+		return 1
+	}
+	z := math.Max(0, math.Abs(u-mean)-0.5) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
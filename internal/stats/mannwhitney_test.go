@@ -0,0 +1,30 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		// R: wilcox.test(1:5, 6:10, exact = FALSE) gives W = 0, p = 0.01219.
+		{"separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.012186},
+		{"separated, swapped", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 0.012186},
+		// U = 5.5 with ties of 3, 4, 2 and 2 values: sigma = sqrt(3 * (13 -
+		// 96/132)), z = 12/sigma.
+		{"ties", []float64{1, 2, 2, 3, 3, 3}, []float64{2, 3, 4, 4, 5, 5}, 0.047968},
+		{"same samples", []float64{10, 20, 30}, []float64{10, 20, 30}, 1},
+		{"all equal", []float64{4, 4, 4}, []float64{4, 4}, 1},
+		{"empty", nil, []float64{1, 2}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MannWhitneyU(tc.a, tc.b); math.Abs(got-tc.want) > 1e-6 {
+				t.Errorf("MannWhitneyU(%v, %v) = %.6f, want %.6f", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}